@@ -0,0 +1,106 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Aliases.
+//
+// People paste rolls from other dice bots and write dice the way they learned
+// them, like "3W6" (German) or "2T6" (Danish), so commands are rewritten into
+// Rolly's own notation before they're split up and rolled. The die letters and
+// any named aliases (like "adv=2d20kh1") come from the settings.
+// -----------------------------------------------------------------------------
+
+// Other bots' commands, which might get pasted in front of a roll.
+var botPrefixes = []string{"/roll", "/r", "!roll", "!r"}
+
+// Roll20-style keep and drop, like "4d6k3" and "4d6d1".
+var keepPattern = regexp.MustCompile(`(?i)(d[0-9]+)([kd])([0-9]+)`)
+
+// ParseAliases - Parse "name=roll; name=..." into aliases.
+//
+// Names are case-insensitive; entries without a name or roll are skipped.
+func ParseAliases(setting string) map[string]string {
+	aliases := make(map[string]string)
+
+	entries := strings.FieldsFunc(setting, func(r rune) bool {
+		return r == ';' || r == '\n'
+	})
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		roll := strings.TrimSpace(parts[1])
+		if len(name) > 0 && len(roll) > 0 {
+			aliases[name] = roll
+		}
+	}
+
+	return aliases
+}
+
+// ParseDieLetters - Turn "W,T" into a pattern that finds dice like "3W6".
+//
+// Returns nil if there aren't any letters.
+func ParseDieLetters(setting string) *regexp.Regexp {
+	var letters []string
+	for _, letter := range strings.Split(setting, ",") {
+		letter = strings.TrimSpace(letter)
+		if len(letter) > 0 {
+			letters = append(letters, regexp.QuoteMeta(letter))
+		}
+	}
+	if len(letters) == 0 {
+		return nil
+	}
+
+	// The die letter can't be part of a word or a number, so "5d10t8" and
+	// "until" are left alone.
+	return regexp.MustCompile(`(?i)(^|[^\pL0-9])([0-9]*)(` + strings.Join(letters, "|") + `)([0-9%({])`)
+}
+
+// ApplyAliases - Rewrite a command into Rolly's own notation.
+func (c *configuration) ApplyAliases(command string) string {
+	command = strings.TrimSpace(command)
+
+	fields := strings.Fields(command)
+	if len(fields) > 0 && isOneOf(fields[0], botPrefixes) {
+		command = strings.TrimSpace(command[len(fields[0]):])
+	}
+
+	// Roll20 inline rolls, like "[[1d20+5]]".
+	command = strings.NewReplacer("[[", " ", "]]", " ").Replace(command)
+
+	var names []string
+	for name := range c.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pattern := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(name) + `\b`)
+		command = pattern.ReplaceAllLiteralString(command, c.aliases[name])
+	}
+
+	if c.dieLetters != nil {
+		// Twice, because matches can't overlap, like "W(W6)".
+		command = c.dieLetters.ReplaceAllString(command, "${1}${2}d${4}")
+		command = c.dieLetters.ReplaceAllString(command, "${1}${2}d${4}")
+	}
+
+	command = keepPattern.ReplaceAllStringFunc(command, func(match string) string {
+		parts := keepPattern.FindStringSubmatch(match)
+		if strings.EqualFold(parts[2], "k") {
+			return parts[1] + "kh" + parts[3]
+		}
+		return parts[1] + "dl" + parts[3]
+	})
+
+	return strings.Join(strings.Fields(command), " ")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Aliases.
+// -----------------------------------------------------------------------------
+
+// TestApplyAliases - Make sure other notations are rewritten.
+func TestApplyAliases(t *testing.T) {
+	p := initTestPlugin(t)
+
+	// These work without any settings.
+	config := p.getConfiguration()
+	assert.EqualValues(t, config.ApplyAliases(" /r 1d20+5 "), "1d20+5")
+	assert.EqualValues(t, config.ApplyAliases("!roll [[1d20+5]] [[2d6]]"), "1d20+5 2d6")
+	assert.EqualValues(t, config.ApplyAliases("4d6k3 4D6d1 4d6kh3"), "4d6kh3 4D6dl1 4d6kh3")
+	assert.EqualValues(t, config.ApplyAliases("3W6"), "3W6")
+
+	p.setConfiguration(&configuration{DieLetters: "W, T", Aliases: "adv=2d20kh1; Stat=4d6kh3"})
+	config = p.getConfiguration()
+	assert.EqualValues(t, config.ApplyAliases("3W6 2t6+1 W(W6)"), "3d6 2d6+1 d(d6)")
+	assert.EqualValues(t, config.ApplyAliases("ADV+5 stat 6x stat"), "2d20kh1+5 4d6kh3 6x 4d6kh3")
+
+	// Letters in words and pool modifiers aren't dice.
+	assert.EqualValues(t, config.ApplyAliases("5d10t8 1d6 until total > 20"), "5d10t8 1d6 until total > 20")
+	assert.EqualValues(t, config.ApplyAliases("advantage"), "advantage")
+}
+
+// TestParseAliases - Make sure the aliases setting is understood.
+func TestParseAliases(t *testing.T) {
+	assert.EqualValues(t, ParseAliases(""), map[string]string{})
+
+	aliases := ParseAliases("Adv=2d20kh1; dis = 2d20kl1\nstat=4d6kh3")
+	assert.EqualValues(t, aliases, map[string]string{"adv": "2d20kh1", "dis": "2d20kl1", "stat": "4d6kh3"})
+
+	// Broken entries are skipped.
+	assert.Empty(t, ParseAliases("nothing; =1d6; empty="))
+}
+
+// TestParseDieLetters - Make sure the die letters setting is understood.
+func TestParseDieLetters(t *testing.T) {
+	assert.Nil(t, ParseDieLetters(""))
+	assert.Nil(t, ParseDieLetters(" , "))
+
+	pattern := ParseDieLetters("W,T")
+	assert.True(t, pattern.MatchString("3w6"))
+	assert.True(t, pattern.MatchString("T%"))
+	assert.False(t, pattern.MatchString("5d10t8"))
+	assert.False(t, pattern.MatchString("3x6"))
+}
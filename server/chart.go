@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// Charts.
+//
+// A table of chances is hard to read, so "/roll stats" draws a histogram in a
+// code block, and links to a PNG bar chart served from /stats/chart.png. The
+// chart can mark a total, like one that was just rolled.
+//
+// Long tails, like exploding dice that could (but won't) go on for ever, are
+// lumped in with the first or last bar, so the bars that matter are readable.
+// -----------------------------------------------------------------------------
+
+const (
+	histogramRows  int = 20 // Most rows in a histogram.
+	histogramWidth int = 30 // Characters in the longest bar.
+
+	chartBars   int = 60 // Most bars in a chart.
+	chartWidth  int = 480
+	chartHeight int = 240
+	chartMargin int = 10
+
+	tailPercent float64 = 0.1 // Chance in each tail that gets lumped in.
+)
+
+// Chart colours: the same green as the roll attachments, and a mark that
+// stands out from it.
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartAxis       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	chartBar        = color.RGBA{0x76, 0xc2, 0xaf, 0xff}
+	chartMark       = color.RGBA{0xe0, 0x7b, 0x39, 0xff}
+)
+
+// HistogramBucket - Totals from Low to High, and their chance.
+//
+// The first bucket's Low can be -Inf, and the last bucket's High can be +Inf,
+// if the tails are lumped in with them.
+type HistogramBucket struct {
+	Low    float64
+	High   float64
+	Chance float64
+}
+
+// Contains - Is this total in the bucket?
+func (b HistogramBucket) Contains(value float64) bool {
+	return b.Low <= value && value <= b.High
+}
+
+// Label - Say what's in the bucket, like "7", "10-14" or "≥ 30".
+func (b HistogramBucket) Label() string {
+	switch {
+	case math.IsInf(b.Low, -1):
+		return "≤ " + FormatValue(b.High)
+	case math.IsInf(b.High, 1):
+		return "≥ " + FormatValue(b.Low)
+	case b.Low == b.High:
+		return FormatValue(b.Low)
+	default:
+		return FormatValue(b.Low) + "-" + FormatValue(b.High)
+	}
+}
+
+// Buckets - Group the totals into at most this many buckets.
+func (d Distribution) Buckets(most int) []HistogramBucket {
+	values := d.Values()
+	low, high := d.Percentile(tailPercent), d.Percentile(100-tailPercent)
+
+	var inside []float64
+	whole := true
+	for _, value := range values {
+		if low <= value && value <= high {
+			inside = append(inside, value)
+		}
+		whole = whole && value == math.Trunc(value)
+	}
+
+	var buckets []HistogramBucket
+	switch {
+	case len(inside) <= most:
+		for _, value := range inside {
+			buckets = append(buckets, HistogramBucket{Low: value, High: value})
+		}
+	case whole:
+		width := math.Ceil((high - low + 1) / float64(most))
+		for start := low; start <= high; start += width {
+			buckets = append(buckets, HistogramBucket{Low: start, High: math.Min(start+width-1, high)})
+		}
+	default:
+		width := (high - low) / float64(most)
+		for idx := 0; idx < most; idx++ {
+			buckets = append(buckets, HistogramBucket{Low: low + float64(idx)*width, High: low + float64(idx+1)*width})
+		}
+		buckets[most-1].High = high
+	}
+
+	if values[0] < low {
+		buckets[0].Low = math.Inf(-1)
+	}
+	if values[len(values)-1] > high {
+		buckets[len(buckets)-1].High = math.Inf(1)
+	}
+
+	for value, chance := range d {
+		for idx := range buckets {
+			if buckets[idx].Contains(value) {
+				buckets[idx].Chance += chance
+				break
+			}
+		}
+	}
+
+	return buckets
+}
+
+// Histogram - Draw the distribution as text, one bar per row, in a code block.
+func (d Distribution) Histogram() string {
+	buckets := d.Buckets(histogramRows)
+
+	labelWidth, tallest := 0, 0.0
+	for _, bucket := range buckets {
+		if width := len([]rune(bucket.Label())); width > labelWidth {
+			labelWidth = width
+		}
+		tallest = math.Max(tallest, bucket.Chance)
+	}
+
+	lines := []string{"```"}
+	for _, bucket := range buckets {
+		label := bucket.Label()
+		label = strings.Repeat(" ", labelWidth-len([]rune(label))) + label
+
+		bar := strings.Repeat("█", int(math.Round(bucket.Chance/tallest*float64(histogramWidth))))
+		if bar == "" && bucket.Chance > 0 {
+			bar = "▏" // There's a chance, just not much of one.
+		}
+
+		lines = append(lines, fmt.Sprintf("%v │%v %v", label, bar, FormatChance(bucket.Chance)))
+	}
+	lines = append(lines, "```")
+
+	return strings.Join(lines, "\n")
+}
+
+// Chart - Draw the distribution as a bar chart, with the bar holding mark in
+// another colour (if mark isn't NaN).
+func (d Distribution) Chart(mark float64) image.Image {
+	chart := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(chart, chart.Bounds(), &image.Uniform{chartBackground}, image.Point{}, draw.Src)
+
+	buckets := d.Buckets(chartBars)
+	tallest := 0.0
+	for _, bucket := range buckets {
+		tallest = math.Max(tallest, bucket.Chance)
+	}
+
+	// Bars with a pixel between them, sitting on the axis.
+	base := chartHeight - chartMargin
+	slot := (chartWidth - 2*chartMargin) / len(buckets)
+	for idx, bucket := range buckets {
+		colour := chartBar
+		if bucket.Contains(mark) {
+			colour = chartMark
+		}
+
+		left := chartMargin + idx*slot
+		top := base - int(math.Round(bucket.Chance/tallest*float64(base-chartMargin)))
+		draw.Draw(chart, image.Rect(left, top, left+slot-1, base), &image.Uniform{colour}, image.Point{}, draw.Src)
+	}
+	draw.Draw(chart, image.Rect(chartMargin, base, chartWidth-chartMargin, base+1), &image.Uniform{chartAxis}, image.Point{}, draw.Src)
+
+	return chart
+}
+
+// ChartURL - Where to get a bar chart of a roll.
+func ChartURL(roll string) string {
+	return "/" + pluginPath + "/stats/chart.png?roll=" + url.QueryEscape(roll)
+}
+
+// MarkedChartURL - Where to get a bar chart of a roll, marking a total.
+func MarkedChartURL(roll string, mark float64) string {
+	return ChartURL(roll) + "&mark=" + url.QueryEscape(FormatValue(mark))
+}
+
+// ServeChart - Serve a bar chart for the roll in the query, like
+// "?roll=2d6+3&mark=11".
+func (p *RollyPlugin) ServeChart(w http.ResponseWriter, r *http.Request) {
+	roll := r.URL.Query().Get("roll")
+
+	// Anyone logged in can ask for anything here, so don't estimate dice that
+	// are too wide to work out exactly.
+	if _, err := p.ExactStats(roll); err == errTooWide {
+		http.Error(w, fmt.Sprintf("I can't work out the odds of that: %v.", err), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := p.Stats(roll)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("I can't work out the odds of that: %v.", err), http.StatusBadRequest)
+		return
+	}
+
+	mark, err := strconv.ParseFloat(r.URL.Query().Get("mark"), 64)
+	if err != nil {
+		mark = math.NaN()
+	}
+
+	var data bytes.Buffer
+	if err := png.Encode(&data, stats.Totals.Chart(mark)); err != nil {
+		http.Error(w, "I can't draw that.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data.Bytes())
+}
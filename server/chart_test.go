@@ -0,0 +1,120 @@
+package main
+
+import (
+	"image/png"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Charts.
+// -----------------------------------------------------------------------------
+
+// TestBuckets - Make sure totals are grouped sensibly.
+func TestBuckets(t *testing.T) {
+	// One bucket per total.
+	buckets := RangeDistribution(1, 4).Buckets(10)
+	assert.EqualValues(t, buckets, []HistogramBucket{{1, 1, 0.25}, {2, 2, 0.25}, {3, 3, 0.25}, {4, 4, 0.25}})
+	assert.EqualValues(t, buckets[0].Label(), "1")
+
+	// Ranges of totals.
+	buckets = RangeDistribution(1, 20).Buckets(5)
+	assert.Len(t, buckets, 5)
+	assert.EqualValues(t, buckets[1], HistogramBucket{5, 8, 0.2})
+	assert.EqualValues(t, buckets[1].Label(), "5-8")
+
+	// The tails are lumped in.
+	sum3d6, _ := SumDistribution(RangeDistribution(1, 6), 3)
+	exploded := ExplodeDistribution(RangeDistribution(1, 6), 6)
+	for _, dist := range []Distribution{sum3d6, exploded} {
+		buckets = dist.Buckets(20)
+		total := 0.0
+		for _, bucket := range buckets {
+			total += bucket.Chance
+		}
+		assert.InDelta(t, total, 1, 1e-12)
+	}
+	buckets = exploded.Buckets(20)
+	assert.EqualValues(t, buckets[0].Label(), "1")
+	assert.True(t, strings.HasPrefix(buckets[len(buckets)-1].Label(), "≥ "))
+	assert.True(t, buckets[len(buckets)-1].Contains(float64(6*explodeDepth+5)))
+
+	buckets = Distribution{-5: 0.0001, 0: 0.5, 1: 0.4998, 9: 0.0001}.Buckets(20)
+	assert.EqualValues(t, buckets[0].Label(), "≤ 0")
+	assert.EqualValues(t, buckets[1].Label(), "≥ 1")
+
+	// Fractions.
+	buckets = RangeDistribution(1, 100).Map(func(value float64) float64 { return value / 8 }).Buckets(4)
+	assert.Len(t, buckets, 4)
+	assert.EqualValues(t, buckets[0].Low, 0.125)
+	assert.EqualValues(t, buckets[3].High, 12.5)
+}
+
+// TestHistogram - Make sure the bars line up.
+func TestHistogram(t *testing.T) {
+	sum2d4, _ := SumDistribution(RangeDistribution(1, 4), 2)
+	assert.EqualValues(t, sum2d4.Histogram(), "```\n"+
+		"2 │"+strings.Repeat("█", 8)+" 6.3%\n"+
+		"3 │"+strings.Repeat("█", 15)+" 12.5%\n"+
+		"4 │"+strings.Repeat("█", 23)+" 18.8%\n"+
+		"5 │"+strings.Repeat("█", 30)+" 25%\n"+
+		"6 │"+strings.Repeat("█", 23)+" 18.8%\n"+
+		"7 │"+strings.Repeat("█", 15)+" 12.5%\n"+
+		"8 │"+strings.Repeat("█", 8)+" 6.3%\n"+
+		"```")
+
+	assert.Contains(t, Distribution{1: 0.98, 2: 0.01, 3: 0.01}.Histogram(), "2 │▏ 1%")
+}
+
+// TestChart - Make sure the chart has bars, and the mark stands out.
+func TestChart(t *testing.T) {
+	chart := RangeDistribution(1, 4).Chart(3)
+	assert.EqualValues(t, chart.Bounds().Dx(), chartWidth)
+	assert.EqualValues(t, chart.Bounds().Dy(), chartHeight)
+
+	// Four bars 115 pixels apart, all the way up.
+	slot := (chartWidth - 2*chartMargin) / 4
+	for idx, colour := range []interface{}{chartBar, chartBar, chartMark, chartBar} {
+		assert.EqualValues(t, chart.At(chartMargin+idx*slot+slot/2, chartMargin), colour, "bar %v", idx)
+	}
+	assert.EqualValues(t, chart.At(chartMargin+slot-1, chartMargin), chartBackground)
+	assert.EqualValues(t, chart.At(chartWidth/2, chartHeight-chartMargin), chartAxis)
+
+	// Nothing marked.
+	chart = RangeDistribution(1, 4).Chart(math.NaN())
+	assert.EqualValues(t, chart.At(chartMargin+2*slot+slot/2, chartMargin), chartBar)
+}
+
+// TestServeChart - Make sure charts are served as PNGs.
+func TestServeChart(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+
+	assert.EqualValues(t, ChartURL("2d6+3"), "/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=2d6%2B3")
+	assert.EqualValues(t, MarkedChartURL("2d6+3", 11), "/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=2d6%2B3&mark=11")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", strings.TrimPrefix(MarkedChartURL("2d6+3", 11), "/plugins/ca.taffer.mm-rolly"), nil)
+	r.Header.Set("Mattermost-User-Id", "userid")
+	p.ServeHTTP(&plugin.Context{}, w, r)
+
+	assert.EqualValues(t, w.Result().StatusCode, 200)
+	assert.EqualValues(t, w.Result().Header.Get("Content-Type"), "image/png")
+	chart, err := png.Decode(w.Result().Body)
+	assert.Nil(t, err)
+	assert.EqualValues(t, chart.Bounds().Dx(), chartWidth)
+
+	w = httptest.NewRecorder()
+	p.ServeChart(w, httptest.NewRequest("GET", "/stats/chart.png?roll=monkey", nil))
+	assert.EqualValues(t, w.Result().StatusCode, 400)
+
+	// Dice too wide to work out exactly aren't estimated for just anyone.
+	w = httptest.NewRecorder()
+	p.ServeChart(w, httptest.NewRequest("GET", "/stats/chart.png?roll=1d2000000000", nil))
+	assert.EqualValues(t, w.Result().StatusCode, 400)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Comparing rolls.
+//
+// "/roll compare 2d6+3 1d12+3" works out both rolls like "/roll stats" (see
+// stats.go), and shows their means and variances, the chance each one is
+// higher, and the chance of each one beating any targets given with "vs". The
+// rolls are independent, so the chance one is higher comes straight from their
+// distributions.
+// -----------------------------------------------------------------------------
+
+// RollComparison - Two rolls, and how they stack up.
+type RollComparison struct {
+	A, B   *RollStats
+	Higher float64 // Chance A is higher than B.
+	Equal  float64 // Chance A and B are equal.
+
+	// For confidence intervals, if either is an estimate; this is the
+	// estimate with the fewest rolls.
+	joint *RollStats
+}
+
+// Compare - Work out two rolls, and the chance the first is higher.
+func (p *RollyPlugin) Compare(rollA string, rollB string) (*RollComparison, error) {
+	a, err := p.Stats(rollA)
+	if err != nil {
+		return nil, fmt.Errorf("I can't work out the odds of %q: %v", rollA, err)
+	}
+	b, err := p.Stats(rollB)
+	if err != nil {
+		return nil, fmt.Errorf("I can't work out the odds of %q: %v", rollB, err)
+	}
+
+	joint := &RollStats{Exact: true}
+	for _, stats := range []*RollStats{a, b} {
+		if !stats.Exact && (joint.Exact || stats.Samples < joint.Samples) {
+			joint = &RollStats{Samples: stats.Samples}
+		}
+	}
+
+	higher, equal := a.Totals.Compare(b.Totals)
+
+	return &RollComparison{A: a, B: b, Higher: higher, Equal: equal, joint: joint}, nil
+}
+
+// Title - Say what's being compared, and how it was worked out.
+func (c *RollComparison) Title() string {
+	if c.joint.Exact {
+		return fmt.Sprintf("⚖️ Comparing %q with %q, worked out exactly:", c.A.Roll, c.B.Roll)
+	}
+
+	return fmt.Sprintf("⚖️ Comparing %q with %q, estimated with 95%% confidence intervals:", c.A.Roll, c.B.Roll)
+}
+
+// Table - The means, variances and chances of beating any targets, side by
+// side, like "12,15,18".
+//
+// Returns the lines of a table.
+func (c *RollComparison) Table(targetList string) []string {
+	var lines []string
+
+	var targets []string
+	if targetList != "" {
+		targets = strings.Split(targetList, ",")
+	}
+	if len(targets) > maxTargets {
+		targets = targets[:maxTargets]
+		lines = append(lines, fmt.Sprintf("That's too many targets, using the first %v.", maxTargets))
+	}
+
+	// Tables need a blank line in front of them.
+	lines = append(lines, "",
+		fmt.Sprintf("| | `%v` | `%v` |", c.A.Roll, c.B.Roll),
+		"|:---|---:|---:|",
+		fmt.Sprintf("| Mean | %v%v | %v%v |",
+			FormatValue(c.A.Totals.Mean()), c.A.meanInterval(), FormatValue(c.B.Totals.Mean()), c.B.meanInterval()),
+		fmt.Sprintf("| Variance | %v | %v |", FormatValue(c.A.Totals.Variance()), FormatValue(c.B.Totals.Variance())))
+
+	for _, target := range targets {
+		value, _ := strconv.Atoi(strings.TrimSpace(target))
+		lines = append(lines, fmt.Sprintf("| ≥ %d | %v | %v |", value,
+			c.A.FormatChance(c.A.Totals.AtLeast(float64(value))), c.B.FormatChance(c.B.Totals.AtLeast(float64(value)))))
+	}
+
+	return lines
+}
+
+// String - Say how often the first one is higher, like "Chance `2d6+3` beats
+// `1d12+3`: **50%**, ...".
+func (c *RollComparison) String() string {
+	return fmt.Sprintf("Chance `%v` beats `%v`: **%v**, ties: **%v**, loses: **%v**.", c.A.Roll, c.B.Roll,
+		c.joint.FormatChance(c.Higher), c.joint.FormatChance(c.Equal), c.joint.FormatChance(1-c.Higher-c.Equal))
+}
+
+// CompareCommand - Compare two rolls, like "2d6+3 1d12+3 vs 12,15".
+func (p *RollyPlugin) CompareCommand(rollArgs string) (*model.CommandResponse, *model.AppError) {
+	response := &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_IN_CHANNEL,
+		Username:     pluginName,
+		IconURL:      iconURI,
+	}
+
+	rolls := SplitRolls(rollArgs)
+	if len(rolls) != 2 {
+		response.ResponseType = model.COMMAND_RESPONSE_TYPE_EPHEMERAL
+		response.Text = "Which two rolls? Like `/roll compare 2d6+3 1d12+3`."
+		return response, nil
+	}
+
+	// The targets stick to the second roll.
+	targets := ""
+	if p.vsPattern.MatchString(rolls[1]) {
+		matches := FindNamedSubstrings(p.vsPattern, rolls[1])
+		rolls[1], targets = matches["roll"], matches["targets"]
+	}
+
+	comparison, err := p.Compare(rolls[0], rolls[1])
+	if err != nil {
+		response.ResponseType = model.COMMAND_RESPONSE_TYPE_EPHEMERAL
+		response.Text = err.Error() + "."
+		return response, nil
+	}
+
+	lines := []string{comparison.Title()}
+	lines = append(lines, comparison.Table(targets)...)
+	// After a blank line, so it isn't read as part of the table.
+	lines = append(lines, "", comparison.String())
+	response.Text = strings.Join(lines, "\n")
+
+	return response, nil
+}
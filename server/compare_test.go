@@ -0,0 +1,89 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Comparing rolls.
+// -----------------------------------------------------------------------------
+
+// TestCompare - Make sure rolls are compared fairly.
+func TestCompare(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	comparison, err := p.Compare("2d6+3", "1d12+3")
+	assert.Nil(t, err)
+	assert.InDelta(t, comparison.Higher, 0.5, 1e-12)
+	assert.InDelta(t, comparison.Equal, 1.0/12, 1e-12)
+	assert.True(t, comparison.joint.Exact)
+
+	comparison, err = p.Compare("1d20", "d20")
+	assert.Nil(t, err)
+	assert.InDelta(t, comparison.Higher, 0.475, 1e-12)
+	assert.InDelta(t, comparison.Equal, 0.05, 1e-12)
+
+	// Estimates are as good as the smallest one.
+	p.setConfiguration(&configuration{StatsSamples: "1000"})
+	comparison, err = p.Compare("1d6 until 6", "(1d4)d6")
+	assert.Nil(t, err)
+	assert.False(t, comparison.joint.Exact)
+	assert.EqualValues(t, comparison.joint.Samples, 1000)
+
+	_, err = p.Compare("2d6", "2d{hit,miss}")
+	assert.EqualValues(t, err.Error(), `I can't work out the odds of "2d{hit,miss}": only dice with numbers on them add up`)
+}
+
+// TestCompareCommand - Make sure the comparison is shown.
+func TestCompareCommand(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+
+	run := func(cmd string) *model.CommandResponse {
+		resp, err := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{Command: cmd})
+		assert.Nil(t, err)
+		return resp
+	}
+
+	resp := run("/roll compare 2d6+3 1d12+3 vs 12,15")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "⚖️ Comparing \"2d6+3\" with \"1d12+3\", worked out exactly:\n"+`
+| | `+"`2d6+3` | `1d12+3`"+` |
+|:---|---:|---:|
+| Mean | 10 | 9.5 |
+| Variance | 5.83 | 11.92 |
+| ≥ 12 | 27.8% | 33.3% |
+| ≥ 15 | 2.8% | 8.3% |
+
+Chance `+"`2d6+3` beats `1d12+3`"+`: **50%**, ties: **8.3%**, loses: **41.7%**.`)
+
+	resp = run("/roll compare 1d6 until 6 1d8")
+	assert.Regexp(t, regexp.MustCompile(`^⚖️ Comparing "1d6 until >= 6" with "1d8", estimated with 95% confidence intervals:
+
+\| \| `+"`1d6 until >= 6` \\| `1d8`"+` \|
+\|:---\|---:\|---:\|
+\| Mean \| [0-9.]+ \([0-9.]+ to [0-9.]+\) \| 4.5 \|
+\| Variance \| [0-9.]+ \| 5.25 \|
+
+Chance .+: \*\*[0-9.]+% \([0-9.]+% to [0-9.]+%\)\*\*, ties: .+, loses: .+\.$`), resp.Text)
+
+	resp = run("/roll compare 2d6 + 3 max(1d20, 1d20)")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.Contains(t, resp.Text, "⚖️ Comparing \"2d6+3\" with \"max(1d20, 1d20)\", worked out exactly:")
+
+	for _, cmd := range []string{"/roll compare 2d6", "/roll compare 1d4 1d6 1d8"} {
+		resp = run(cmd)
+		assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL, cmd)
+		assert.EqualValues(t, resp.Text, "Which two rolls? Like `/roll compare 2d6+3 1d12+3`.", cmd)
+	}
+
+	resp = run("/roll compare 1d6/(1d2-1) 2d6")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, `I can't work out the odds of "1d6/(1d2-1)": you can't divide by zero.`)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Plugin configuration.
+//
+// The settings are declared in plugin.json; Mattermost hands them to us in
+// OnConfigurationChange(). Based on the Mattermost plugin sample.
+// -----------------------------------------------------------------------------
+
+// configuration - The plugin's settings, plus anything we work out from them.
+type configuration struct {
+	// Named custom dice, like "fib=1,1,2,3,5,8; avg=2,3,3,4,4,5".
+	CustomDice string
+
+	// How "/" rounds: "down", "up", "nearest" or "none".
+	DivisionRounding string
+
+	// What to do with totals below zero: "allow", "zero" or "one".
+	NegativeTotals string
+
+	// What crit does to damage dice: "double" them, or add their "max".
+	CritMode string
+
+	// Letters that mean "d" in other languages, like "W,T".
+	DieLetters string
+
+	// Named rolls, like "adv=2d20kh1; stat=4d6kh3".
+	Aliases string
+
+	// Where the randomness comes from: "math", "crypto" or "pcg".
+	RNG string
+
+	// Roll with a published seed, so rolls can be checked; see fair.go.
+	ProvablyFair bool
+
+	// Add signed receipts to rolls; see receipts.go.
+	SignRolls bool
+
+	// How many rolls, and how many seconds, to estimate stats with; see
+	// simulate.go.
+	StatsSamples string
+	StatsTimeout string
+
+	// How many rolls to keep in each channel; see history.go.
+	HistorySize string
+
+	// CustomDice, parsed.
+	customDice map[string][]string
+
+	// DieLetters and Aliases, parsed; see aliases.go.
+	dieLetters *regexp.Regexp
+	aliases    map[string]string
+}
+
+// getConfiguration - Get the active configuration.
+//
+// Never returns nil, and the result must be treated as read-only; use
+// setConfiguration() to change it.
+func (p *RollyPlugin) getConfiguration() *configuration {
+	p.configurationLock.RLock()
+	defer p.configurationLock.RUnlock()
+
+	if p.configuration == nil {
+		return &configuration{}
+	}
+
+	return p.configuration
+}
+
+// setConfiguration - Replace the active configuration.
+func (p *RollyPlugin) setConfiguration(config *configuration) {
+	p.configurationLock.Lock()
+	defer p.configurationLock.Unlock()
+
+	config.customDice = ParseCustomDice(config.CustomDice)
+	config.dieLetters = ParseDieLetters(config.DieLetters)
+	config.aliases = ParseAliases(config.Aliases)
+
+	p.configuration = config
+
+	// The odds might be different now.
+	p.clearStats()
+}
+
+// OnConfigurationChange - Load the new settings.
+func (p *RollyPlugin) OnConfigurationChange() error {
+	config := new(configuration)
+
+	if err := p.API.LoadPluginConfiguration(config); err != nil {
+		return err
+	}
+
+	p.setConfiguration(config)
+
+	return nil
+}
+
+// ParseCustomDice - Parse "name=face,face,...; name=..." into named dice.
+//
+// Names are case-insensitive; entries without a name or faces are skipped.
+func ParseCustomDice(setting string) map[string][]string {
+	dice := make(map[string][]string)
+
+	entries := strings.FieldsFunc(setting, func(r rune) bool {
+		return r == ';' || r == '\n'
+	})
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		faces := SplitFaces(parts[1])
+		if len(name) > 0 && len(faces) > 0 {
+			dice[name] = faces
+		}
+	}
+
+	return dice
+}
+
+// SplitFaces - Split "1, 1,2" into faces, or nil if any of them are empty.
+func SplitFaces(faceList string) []string {
+	var faces []string
+
+	for _, face := range strings.Split(faceList, ",") {
+		face = strings.TrimSpace(face)
+		if len(face) == 0 {
+			return nil
+		}
+		faces = append(faces, face)
+	}
+
+	return faces
+}
+
+// ClampTotal - Apply the NegativeTotals setting to a total.
+func (c *configuration) ClampTotal(total float64) float64 {
+	switch {
+	case c.NegativeTotals == "zero" && total < 0:
+		return 0
+	case c.NegativeTotals == "one" && total < 1:
+		return 1
+	default:
+		return total
+	}
+}
+
+// Samples - Apply the StatsSamples setting, or use the default.
+func (c *configuration) Samples() int {
+	samples, err := strconv.Atoi(strings.TrimSpace(c.StatsSamples))
+	if err != nil || samples < 1 {
+		return defaultSamples
+	}
+	if samples > maxSamples {
+		return maxSamples
+	}
+
+	return samples
+}
+
+// Retention - Apply the HistorySize setting, or use the default; 0 turns the
+// history off.
+func (c *configuration) Retention() int {
+	size, err := strconv.Atoi(strings.TrimSpace(c.HistorySize))
+	if err != nil || size < 0 {
+		return defaultRetention
+	}
+	if size > maxRetention {
+		return maxRetention
+	}
+
+	return size
+}
+
+// Timeout - Apply the StatsTimeout setting, or use the default.
+func (c *configuration) Timeout() time.Duration {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(c.StatsTimeout), 64)
+	if err != nil || seconds <= 0 {
+		return defaultTimeout
+	}
+	if seconds > maxTimeout.Seconds() {
+		return maxTimeout
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Plugin configuration.
+// -----------------------------------------------------------------------------
+
+// TestOnConfigurationChange - Make sure settings get loaded.
+func TestOnConfigurationChange(t *testing.T) {
+	p := initTestPlugin(t)
+
+	// No settings yet, but never nil.
+	assert.NotNil(t, p.getConfiguration())
+	assert.Empty(t, p.getConfiguration().customDice)
+
+	assert.Nil(t, p.OnConfigurationChange())
+	assert.NotNil(t, p.getConfiguration().customDice)
+}
+
+// TestSetConfiguration - Make sure derived settings are worked out.
+func TestSetConfiguration(t *testing.T) {
+	p := initTestPlugin(t)
+
+	p.setConfiguration(&configuration{CustomDice: "fib=1,1,2,3,5,8"})
+	assert.EqualValues(t, p.getConfiguration().customDice["fib"], []string{"1", "1", "2", "3", "5", "8"})
+	assert.Nil(t, p.getConfiguration().dieLetters)
+
+	p.setConfiguration(&configuration{DieLetters: "W", Aliases: "adv=2d20kh1"})
+	assert.NotNil(t, p.getConfiguration().dieLetters)
+	assert.EqualValues(t, p.getConfiguration().aliases["adv"], "2d20kh1")
+}
+
+// TestParseCustomDice - Make sure the custom dice setting is understood.
+func TestParseCustomDice(t *testing.T) {
+	assert.EqualValues(t, ParseCustomDice(""), map[string][]string{})
+
+	dice := ParseCustomDice("Fib=1,1,2,3,5,8; dread = hit, miss ,miss\navg=2,3,3,4,4,5")
+	assert.EqualValues(t, dice["fib"], []string{"1", "1", "2", "3", "5", "8"})
+	assert.EqualValues(t, dice["dread"], []string{"hit", "miss", "miss"})
+	assert.EqualValues(t, dice["avg"], []string{"2", "3", "3", "4", "4", "5"})
+
+	// Broken entries are skipped.
+	dice = ParseCustomDice("nothing; =1,2; empty=; gap=1,,2")
+	assert.Empty(t, dice)
+}
+
+// TestSplitFaces - Make sure face lists are split and trimmed.
+func TestSplitFaces(t *testing.T) {
+	assert.EqualValues(t, SplitFaces("1"), []string{"1"})
+	assert.EqualValues(t, SplitFaces(" hit, miss "), []string{"hit", "miss"})
+	assert.Nil(t, SplitFaces(""))
+	assert.Nil(t, SplitFaces("1,,2"))
+}
+
+// TestClampTotal - Make sure the NegativeTotals setting is applied.
+func TestClampTotal(t *testing.T) {
+	config := &configuration{}
+	assert.EqualValues(t, config.ClampTotal(-3), -3)
+
+	config.NegativeTotals = "allow"
+	assert.EqualValues(t, config.ClampTotal(-3), -3)
+
+	config.NegativeTotals = "zero"
+	assert.EqualValues(t, config.ClampTotal(-3), 0)
+	assert.EqualValues(t, config.ClampTotal(0.5), 0.5)
+
+	config.NegativeTotals = "one"
+	assert.EqualValues(t, config.ClampTotal(-3), 1)
+	assert.EqualValues(t, config.ClampTotal(0), 1)
+	assert.EqualValues(t, config.ClampTotal(3), 3)
+}
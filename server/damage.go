@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// -----------------------------------------------------------------------------
+// Damage rolls.
+//
+// "damage 1d8+3 slashing + 2d6 fire crit resist fire" rolls the expression with
+// the damage types as labels, so each type gets its own total. A crit doubles
+// (or maximises) the dice but not the modifiers, and resistance, vulnerability
+// and immunity halve, double or ignore the matching types.
+// -----------------------------------------------------------------------------
+
+// Ways to adjust damage, and how to describe them.
+var damageAdjustments = map[string]string{
+	"resist": "resistant",
+	"vuln":   "vulnerable",
+	"immune": "immune",
+}
+
+// RollDamage - Roll damage, like "1d8+3 slashing + 2d6 fire crit resist fire".
+func (p *RollyPlugin) RollDamage(rollArg string, damage string) RollResult {
+	result := RollResult{Roll: rollArg}
+
+	terms, isCrit, adjustments := SplitDamage(damage)
+	expr, err := p.ParseExpression(terms)
+	if err != nil {
+		result.Text = fmt.Sprintf("I have no idea what to do with this: %v", rollArg)
+		return result
+	}
+
+	crit := ""
+	if isCrit {
+		crit = p.getConfiguration().CritMode
+		if crit != "max" {
+			crit = "double"
+		}
+	}
+
+	rolled, notes, err := p.rollExpression(expr, crit)
+	result.Notes = notes
+	if err != nil {
+		result.Text = fmt.Sprintf("%q can't be rolled: %v.", rollArg, err)
+		return result
+	}
+
+	total := rolled.value
+	var types []string
+	for _, label := range rolled.labels {
+		adjustment := adjustments[strings.ToLower(label.Label)]
+
+		adjusted := label.Total
+		switch adjustment {
+		case "resist":
+			adjusted = math.Floor(label.Total / 2)
+		case "vuln":
+			adjusted = label.Total * 2
+		case "immune":
+			adjusted = 0
+		}
+		total += adjusted - label.Total
+
+		if adjustment == "" {
+			types = append(types, fmt.Sprintf("%v: **%v**", label.Label, FormatValue(adjusted)))
+		} else {
+			types = append(types, fmt.Sprintf("%v: %v → **%v** (%v)", label.Label, FormatValue(label.Total), FormatValue(adjusted), damageAdjustments[adjustment]))
+		}
+		result.Labels = append(result.Labels, RollLabel{Label: label.Label, Total: adjusted})
+	}
+
+	result.Dice, result.Worked = rolled.detail, true
+	result.Total = p.getConfiguration().ClampTotal(total)
+	result.Answer = FormatValue(result.Total)
+	if crit != "" {
+		result.Extra = append(result.Extra, "💥 Critical hit!")
+	}
+	if len(types) > 0 {
+		result.Extra = append(result.Extra, strings.Join(types, ", "))
+	}
+
+	return result
+}
+
+// SplitDamage - Split "1d8+3 slashing crit resist fire" into its parts.
+//
+// Returns the roll with the damage types as labels, like "1d8+3 [slashing]",
+// whether it's a crit, and a map of damage types to "resist", "vuln" or
+// "immune".
+func SplitDamage(damage string) (string, bool, map[string]string) {
+	crit := false
+	adjustments := make(map[string]string)
+	var terms []string
+
+	fields := strings.Fields(damage)
+	for idx := 0; idx < len(fields); idx++ {
+		word := strings.ToLower(fields[idx])
+		if _, ok := damageAdjustments[word]; ok && idx+1 < len(fields) {
+			// Like "resist fire,cold".
+			idx++
+			for _, damageType := range strings.Split(strings.ToLower(fields[idx]), ",") {
+				adjustments[damageType] = word
+			}
+		} else if word == "crit" {
+			crit = true
+		} else if isDamageType(word) {
+			terms = append(terms, "["+word+"]")
+		} else {
+			terms = append(terms, fields[idx])
+		}
+	}
+
+	return strings.Join(terms, " "), crit, adjustments
+}
+
+// Is this word a damage type, like "fire", rather than part of the roll?
+func isDamageType(word string) bool {
+	for _, r := range word {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	if _, ok := exprFunctions[word]; ok {
+		return false
+	}
+
+	return word != "" && !isOneOf(word, []string{"d", "df", "x", "nat"}) && !isOneOf(word, joinWords)
+}
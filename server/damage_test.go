@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Damage rolls.
+// -----------------------------------------------------------------------------
+
+// TestRollDamage - Make sure damage types are added up and adjusted.
+func TestRollDamage(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response := p.HandleRoll("damage 1d8+3 slashing + 2d6 fire", "")
+	assert.EqualValues(t, response, "\"damage 1d8+3[slashing]+2d6[fire]\" 1d8 [3] + 3 *slashing* + 2d6 [1 2] *fire* = **9**\nslashing: **6**, fire: **3**")
+
+	response = p.HandleRoll("damage 1d8+3 slashing + 2d6 fire crit resist fire", "")
+	assert.EqualValues(t, response, "\"damage 1d8+3[slashing]+2d6[fire] crit resist fire\" 2d8 [3 4] + 3 *slashing* + 4d6 [1 2 5 6] *fire* = **17**\n💥 Critical hit!\nslashing: **10**, fire: 14 → **7** (resistant)")
+
+	response = p.HandleRoll("damage 2d6 fire + 1d4 poison immune poison vuln fire", "")
+	assert.EqualValues(t, response, "\"damage 2d6[fire]+1d4[poison] vuln fire immune poison\" 2d6 [1 1] *fire* + 1d4 [4] *poison* = **4**\nfire: 2 → **4** (vulnerable), poison: 4 → **0** (immune)")
+
+	response = p.HandleRoll("damage monkey", "")
+	assert.EqualValues(t, response, "I have no idea what to do with this: damage monkey")
+
+	result := p.RollOne("damage 1d6 fire + 1d6 cold resist fire,cold")
+	assert.EqualValues(t, len(result.Labels), 2)
+	assert.EqualValues(t, result.Total, result.Labels[0].Total+result.Labels[1].Total)
+
+	p.setConfiguration(&configuration{CritMode: "max"})
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response = p.HandleRoll("damage 2d6+3 fire crit", "")
+	assert.EqualValues(t, response, "\"damage 2d6+3[fire] crit\" 2d6 [1 1] + crit [6 6] + 3 *fire* = **17**\n💥 Critical hit!\nfire: **17**")
+}
+
+// TestIsDamageType - Make sure damage types aren't mixed up with the roll.
+func TestIsDamageType(t *testing.T) {
+	assert.True(t, isDamageType("fire"))
+	assert.True(t, isDamageType("bludgeoning"))
+
+	assert.False(t, isDamageType(""))
+	assert.False(t, isDamageType("d"))
+	assert.False(t, isDamageType("max"))
+	assert.False(t, isDamageType("1d6"))
+	assert.False(t, isDamageType("until"))
+}
@@ -7,48 +7,109 @@ import (
 	"strings"
 )
 
+// RollLabel - The total of the terms with a label, like "2d6[fire]".
+type RollLabel struct {
+	Label string
+	Total float64
+}
+
+// RollResult - What happened when something got rolled.
+type RollResult struct {
+	Roll   string      // What was rolled, like "2d6+3".
+	Notes  []string    // Complaints, like "1000 is too many, rolling 100."
+	Dice   string      // The dice rolled, like "[3 4]", if they're worth showing.
+	Worked bool        // Is Dice all of the working, like "2d6 [3 4] + 3"?
+	Total  float64     // The total, for adding things up.
+	Answer string      // How to show the total, like "10" or "2 successes".
+	Extra  []string    // Lines to show after the total.
+	Labels []RollLabel // Totals for each label, like "fire".
+	Text   string      // Shown instead of everything but the notes, if set.
+}
+
+// String - Format the result like "\"2d6+3\" [3 4] = **10**".
+func (r RollResult) String() string {
+	text := ""
+	for _, note := range r.Notes {
+		text += note + "\n"
+	}
+
+	return text + r.format(strconv.Quote(r.Roll))
+}
+
+// Line - Format the result without notes or quotes, like "2d6 [3 4] = **7**".
+//
+// If the dice show all of the working, the roll itself is left out.
+func (r RollResult) Line() string {
+	if r.Worked {
+		return r.format("")
+	}
+
+	return r.format(r.Roll)
+}
+
+func (r RollResult) format(roll string) string {
+	if r.Text != "" {
+		return r.Text
+	}
+
+	text := strings.TrimSpace(roll + " " + r.Dice)
+	text += fmt.Sprintf(" = **%v**", r.Answer)
+	for _, line := range r.Extra {
+		text += "\n" + line
+	}
+
+	return text
+}
+
+// HandleRolls - Roll each of the rolls in a request, on their own lines.
+func (p *RollyPlugin) HandleRolls(rolls []string, rollText string) string {
+	return FormatResults(p.RollRequests(rolls), rollText)
+}
+
+// FormatResults - Add each of the results to the roll output, on their own
+// lines.
+func FormatResults(results []RollResult, rollText string) string {
+	for _, result := range results {
+		rollText += "\n🎲 " + result.String()
+	}
+
+	return rollText
+}
+
 // HandleRoll - Handle a rolling command.
 //
 // Returns the adjusted roll output.
 func (p *RollyPlugin) HandleRoll(rollArg string, rollText string) string {
-	if p.simplePattern.MatchString(rollArg) == true {
-		// Simple roll (number only).
-		matches := FindNamedSubstrings(p.simplePattern, rollArg)
+	return rollText + p.RollRequest(rollArg).String()
+}
 
-		if matches["num_sides"] == "1" {
-			rollText += "Your one-sided die rolls off into the shadows."
-		} else {
-			dice, total := p.RollDice(1, matches["num_sides"], "", 0)
+// RollRequests - Roll each of the rolls in a request.
+func (p *RollyPlugin) RollRequests(rolls []string) []RollResult {
+	var results []RollResult
+	for _, roll := range rolls {
+		results = append(results, p.RollRequest(roll))
+	}
 
-			if len(dice) == 1 {
-				rollText += fmt.Sprintf("\"1d%v\" = **%d**", rollArg, total)
-			} else {
-				rollText += fmt.Sprintf("%q %v = **%d**", rollArg, dice, total)
-			}
-		}
+	return results
+}
 
-	} else if p.comboPattern.MatchString(rollArg) == true {
+// RollRequest - Roll anything, like "dnd", "6x 4d6kh3" or "2d6+3".
+//
+// Combos and repeated rolls only have their Text.
+func (p *RollyPlugin) RollRequest(rollArg string) RollResult {
+	if p.comboPattern.MatchString(rollArg) == true {
 		// C-C-C-C-COMBO roll.
 		matches := FindNamedSubstrings(p.comboPattern, rollArg)
+		result := RollResult{Roll: p.Normalize(rollArg)}
 
 		comboName := strings.ToLower(matches["combo_name"])
 		switch comboName {
 		case "dnd", "d&d":
 			// D&D/Pathfinder: 3d6 for each stat.
-			rollText += "D&D standard:"
-
-			for idx := 0; idx < 6; idx++ {
-				dice, total := p.RollDice(3, "6", "", 0)
-				rollText += fmt.Sprintf("\n* 3d6 %v = **%d**", dice, total)
-			}
+			result.Text = p.RepeatRoll("D&D standard:", 6, "3d6", nil)
 		case "dnd+", "d&d+":
 			// Common D&D/Pathfinder house rule: 4d6<1 for each stat.
-			rollText += "D&D variant:"
-
-			for idx := 0; idx < 6; idx++ {
-				dice, total := p.RollDice(4, "6", "<", 1)
-				rollText += fmt.Sprintf("\n* 4d6<1 %v = **%d**", dice, total)
-			}
+			result.Text = p.RepeatRoll("D&D variant:", 6, "4d6<1", nil)
 		case "open":
 			// Rolemaster open-ended d%.
 			dice, total := p.RollDice(1, "%", "", 0)
@@ -60,33 +121,163 @@ func (p *RollyPlugin) HandleRoll(rollArg string, rollText string) string {
 
 			sort.Ints(allDice)
 			total = sum(allDice)
-			rollText += fmt.Sprintf("Rolemaster open-ended: 1d%% %v = **%d**", allDice, total)
+			result.Text = fmt.Sprintf("Rolemaster open-ended: 1d%% %v = **%d**", allDice, total)
 		default:
 			// You can't actually reach this with the current regex.
-			rollText += fmt.Sprintf("Combo **%v** isn't implemented yet, sorry.", rollArg)
+			result.Text = fmt.Sprintf("Combo **%v** isn't implemented yet, sorry.", rollArg)
 		}
 
-	} else if p.rollPattern.MatchString(rollArg) == true {
-		// Typical roll (number of dice, sides, optional modifiers).
-		matches := FindNamedSubstrings(p.rollPattern, rollArg)
+		return result
+	} else if p.repeatPattern.MatchString(rollArg) == true {
+		// The same roll several times, like "6x 4d6kh3" or "{4d6kh3}*6".
+		matches := FindNamedSubstrings(p.repeatPattern, rollArg)
+		result := RollResult{Roll: p.Normalize(rollArg)}
 
-		numDice, err := strconv.Atoi(matches["num_dice"])
-		if err != nil {
-			// This is optional, so it might be empty.
-			numDice = 1
+		roll, countMatch := matches["roll"], matches["count"]
+		if roll == "" {
+			roll, countMatch = matches["brace_roll"], matches["brace_count"]
+		}
+
+		var count int
+		count, result.Notes = clampRepeats(countMatch, result.Notes)
+
+		var aggregates []string
+		fields := strings.Fields(strings.ToLower(matches["aggregates"]))
+		for idx := 0; idx < len(fields); idx++ {
+			if fields[idx] == "best" || fields[idx] == "worst" {
+				idx++
+				aggregates = append(aggregates, fields[idx-1]+" "+fields[idx])
+			} else {
+				aggregates = append(aggregates, fields[idx])
+			}
+		}
+
+		result.Text = p.RepeatRoll(fmt.Sprintf("%q:", result.Roll), count, roll, aggregates)
+
+		return result
+	}
+
+	return p.RollOne(rollArg)
+}
+
+// RepeatRoll - Roll the same thing {count} times, one line each.
+//
+// The aggregates can "sort" the rolls (best first), add up their "sum", or add
+// up the "best N" or "worst N" of them.
+func (p *RollyPlugin) RepeatRoll(title string, count int, roll string, aggregates []string) string {
+	var results []RollResult
+	for idx := 0; idx < count; idx++ {
+		results = append(results, p.RollOne(roll))
+	}
+
+	if results[0].Text != "" {
+		// It didn't work the first time, and it won't work any other time.
+		return results[0].String()
+	}
+
+	rollText := ""
+	seen := make(map[string]bool)
+	for _, result := range results {
+		for _, note := range result.Notes {
+			if !seen[note] {
+				rollText += note + "\n"
+				seen[note] = true
+			}
 		}
-		if numDice > 100 {
-			rollText += fmt.Sprintf("%v is too many, rolling 100.\n", numDice)
-			numDice = 100
+	}
+
+	totals := make([]float64, len(results))
+	for idx, result := range results {
+		totals[idx] = result.Total
+	}
+	sort.Float64s(totals)
+
+	var summary []string
+	for _, aggregate := range aggregates {
+		words := strings.Fields(aggregate)
+
+		switch words[0] {
+		case "sort":
+			sort.SliceStable(results, func(i, j int) bool {
+				return results[i].Total > results[j].Total
+			})
+		case "sum":
+			total := 0.0
+			for _, value := range totals {
+				total += value
+			}
+			summary = append(summary, fmt.Sprintf("Sum: **%v**", FormatValue(total)))
+		case "best", "worst":
+			n, _ := strconv.Atoi(words[1])
+			n = min(n, len(totals))
+
+			// The totals are sorted worst first.
+			var picked []string
+			total := 0.0
+			for idx := 0; idx < n; idx++ {
+				value := totals[idx]
+				if words[0] == "best" {
+					value = totals[len(totals)-1-idx]
+				}
+				picked = append(picked, FormatValue(value))
+				total += value
+			}
+			summary = append(summary, fmt.Sprintf("%v %d: [%v] = **%v**", strings.Title(words[0]), n, strings.Join(picked, " "), FormatValue(total)))
 		}
-		if numDice < 1 {
-			rollText += fmt.Sprintf("%v is too few, rolling 1.\n", numDice)
-			numDice = 1
+	}
+
+	rollText += title
+	for _, result := range results {
+		rollText += "\n* " + result.Line()
+	}
+	for _, line := range summary {
+		rollText += "\n" + line
+	}
+
+	return rollText
+}
+
+// RollOne - Roll a single thing, like "2d6+3" or "5d10e9".
+func (p *RollyPlugin) RollOne(rollArg string) RollResult {
+	result := RollResult{Roll: rollArg}
+
+	if p.vsPattern.MatchString(rollArg) == true {
+		// One roll against several targets, like "1d20+6 vs 12,15,18".
+		matches := FindNamedSubstrings(p.vsPattern, rollArg)
+
+		result = p.RollOne(matches["roll"])
+		if result.Text == "" {
+			result.Extra = append(result.Extra, CompareTargets(result.Total, matches["targets"])...)
 		}
+	} else if p.damagePattern.MatchString(rollArg) == true {
+		// Damage with types, like "damage 1d8+3 slashing + 2d6 fire crit".
+		matches := FindNamedSubstrings(p.damagePattern, rollArg)
+
+		result = p.RollDamage(rollArg, matches["damage"])
+	} else if p.simplePattern.MatchString(rollArg) == true {
+		// Simple roll (number only).
+		matches := FindNamedSubstrings(p.simplePattern, rollArg)
+
+		if oneSided(matches["num_sides"]) {
+			result.Text = "Your one-sided die rolls off into the shadows."
+		} else {
+			var sides string
+			sides, result.Notes = clampSides(matches["num_sides"], result.Notes)
+			_, total := p.RollDice(1, sides, "", 0)
+
+			result.Total, result.Answer = float64(total), strconv.Itoa(total)
+		}
+	} else if p.rollPattern.MatchString(rollArg) == true && !p.isZeroBased(rollArg) {
+		// Typical roll (number of dice, sides, optional modifiers).
+		matches := FindNamedSubstrings(p.rollPattern, rollArg)
+
+		var numDice int
+		numDice, result.Notes = clampDice(matches["num_dice"], result.Notes)
 		sides := matches["num_sides"] // Left as string for d% rolls.
-		if sides == "1" {
-			rollText += "Your one-sided die rolls off into the shadows."
+		if oneSided(sides) {
+			result.Text = "Your one-sided die rolls off into the shadows."
 		} else {
+			sides, result.Notes = clampSides(sides, result.Notes)
 			modifier := matches["modifier"]
 			modifierValue, err := strconv.Atoi(matches["modifier_value"])
 			if err != nil {
@@ -95,17 +286,232 @@ func (p *RollyPlugin) HandleRoll(rollArg string, rollText string) string {
 
 			dice, total := p.RollDice(numDice, sides, modifier, modifierValue)
 
-			if len(dice) == 1 {
-				rollText += fmt.Sprintf("%q = **%d**", rollArg, total)
+			if len(dice) > 1 {
+				result.Dice = fmt.Sprint(dice)
+			}
+			result.Total, result.Answer = float64(total), strconv.Itoa(total)
+		}
+	} else if p.poolPattern.MatchString(rollArg) == true {
+		// Storyteller dice pool (count successes instead of adding).
+		matches := FindNamedSubstrings(p.poolPattern, rollArg)
+
+		var numDice int
+		numDice, result.Notes = clampDice(matches["num_dice"], result.Notes)
+
+		rules, _, notes := p.parsePoolMods(matches)
+		result.Notes = append(result.Notes, notes...)
+
+		chains, successes := p.RollPool(numDice, rules.again, rules.target, rules.rote, rules.double)
+
+		noun := "successes"
+		if successes == 1 {
+			noun = "success"
+		}
+		result.Dice = FormatChains(chains)
+		result.Total, result.Answer = float64(successes), fmt.Sprintf("%d %v", successes, noun)
+	} else if p.d6Pattern.MatchString(rollArg) == true {
+		// West End Games D6 System: one of the dice is the wild die.
+		matches := FindNamedSubstrings(p.d6Pattern, rollArg)
+
+		var numDice int
+		numDice, result.Notes = clampDice(matches["num_dice"], result.Notes)
+		pips, err := strconv.Atoi(matches["modifier_value"])
+		if err != nil {
+			pips = 0 // One wasn't specified.
+		}
+		if matches["modifier"] == "-" {
+			pips = -pips
+		}
+
+		dice, total := p.RollDice(numDice-1, "6", "", 0)
+		wild, wildTotal := p.RollDice(1, "6", "!", 0)
+		total += wildTotal + pips
+
+		result.Dice = "wild " + FormatChains([][]int{wild})
+		if len(dice) > 0 {
+			result.Dice = fmt.Sprintf("%v %v", dice, result.Dice)
+		}
+		result.Total, result.Answer = float64(total), strconv.Itoa(total)
+
+		if wild[0] == 1 {
+			// The wild die is sorted, so the highest die is the last one.
+			dropped := pips
+			if len(dice) > 0 {
+				dropped += sum(dice[:len(dice)-1])
+			}
+			result.Extra = append(result.Extra, fmt.Sprintf("⚠️ The wild die rolled a 1: GM's choice of a complication, or dropping the wild die and the highest die for **%d**.", dropped))
+		}
+	} else if p.facesPattern.MatchString(rollArg) == true {
+		// Dice with custom faces, either listed or named in the settings.
+		matches := FindNamedSubstrings(p.facesPattern, rollArg)
+
+		faces := SplitFaces(matches["faces"])
+		if named, ok := p.getConfiguration().customDice[strings.ToLower(strings.TrimSpace(matches["faces"]))]; ok {
+			faces = named
+		}
+
+		if len(faces) == 0 {
+			result.Text = fmt.Sprintf("I have no idea what to do with this: %v", rollArg)
+		} else if len(faces) == 1 && !isNumber(faces[0]) {
+			result.Text = fmt.Sprintf("I don't know a custom die called %v.", faces[0])
+		} else {
+			var numDice int
+			numDice, result.Notes = clampDice(matches["num_dice"], result.Notes)
+
+			rolled, total, numeric := p.RollFaces(numDice, faces)
+			if len(rolled) > 1 {
+				result.Dice = fmt.Sprint(rolled)
+			}
+			if numeric {
+				result.Total, result.Answer = float64(total), strconv.Itoa(total)
+			} else if len(rolled) == 1 {
+				result.Answer = rolled[0]
 			} else {
-				rollText += fmt.Sprintf("%q %v = **%d**", rollArg, dice, total)
+				result.Answer = CountFaces(rolled, faces)
 			}
 		}
+	} else if expr, err := p.ParseExpression(rollArg); err == nil {
+		// Anything else that makes sense as an expression, like "2d6+5..15".
+		rolled, notes, err := p.RollExpression(expr)
+		result.Notes = notes
+
+		result.Total = p.getConfiguration().ClampTotal(rolled.value)
+		result.Answer = FormatValue(result.Total)
+		if rolled.isBool && rolled.value != 0 {
+			result.Answer = "yes"
+		} else if rolled.isBool {
+			result.Answer = "no"
+		}
+
+		result.Labels = rolled.labels
+		if len(result.Labels) > 1 {
+			var totals []string
+			for _, label := range result.Labels {
+				totals = append(totals, fmt.Sprintf("%v: **%v**", label.Label, FormatValue(label.Total)))
+			}
+			result.Extra = append(result.Extra, strings.Join(totals, ", "))
+		}
+
+		if err != nil {
+			result.Text = fmt.Sprintf("%q can't be rolled: %v.", rollArg, err)
+		} else if dice, ok := expr.(*diceNode); ok && dice.isSimple() && len(rolled.rolls) > 1 {
+			result.Dice = fmt.Sprint(rolled.rolls)
+		} else if !ok || !dice.isSimple() {
+			result.Dice, result.Worked = rolled.detail, true
+		}
 	} else {
-		rollText += fmt.Sprintf("I have no idea what to do with this: %v", rollArg)
+		result.Text = fmt.Sprintf("I have no idea what to do with this: %v", rollArg)
 	}
 
-	return rollText
+	// Show what was actually rolled, like "1d3" for "d3".
+	result.Roll = p.Normalize(rollArg)
+
+	return result
+}
+
+// CompareTargets - Compare a total against a list of targets like "12,15,18".
+//
+// Returns the lines of a table of targets, hits or misses, and margins.
+func CompareTargets(total float64, targetList string) []string {
+	var lines []string
+
+	targets := strings.Split(targetList, ",")
+	if len(targets) > maxTargets {
+		targets = targets[:maxTargets]
+		lines = append(lines, fmt.Sprintf("That's too many targets, using the first %v.", maxTargets))
+	}
+
+	// Tables need a blank line in front of them.
+	lines = append(lines, "", "| Target | Result | Margin |", "|---:|:---|---:|")
+
+	for _, target := range targets {
+		value, _ := strconv.Atoi(strings.TrimSpace(target))
+		margin := total - float64(value)
+
+		outcome := "❌ miss"
+		if margin >= 0 {
+			outcome = "✅ hit"
+		}
+
+		sign := ""
+		if margin >= 0 {
+			sign = "+"
+		}
+		lines = append(lines, fmt.Sprintf("| %d | %v | %v%v |", value, outcome, sign, FormatValue(margin)))
+	}
+
+	return lines
+}
+
+// isZeroBased - Is this a zero-based die like d0-9, not a roll with a modifier?
+func (p *RollyPlugin) isZeroBased(rollArg string) bool {
+	matches := FindNamedSubstrings(p.rollPattern, rollArg)
+
+	return matches["num_sides"] == "0" && matches["modifier"] == "-"
+}
+
+// clampDice - Turn the num_dice match into a reasonable number of dice.
+//
+// Returns the number of dice, and the notes with any complaints added.
+func clampDice(numDiceMatch string, notes []string) (int, []string) {
+	numDice, err := strconv.Atoi(numDiceMatch)
+	if err != nil {
+		// This is optional, so it might be empty.
+		numDice = 1
+	}
+	if numDice > maxDice {
+		notes = append(notes, fmt.Sprintf("%v is too many, rolling %v.", numDice, maxDice))
+		numDice = maxDice
+	}
+	if numDice < 1 {
+		notes = append(notes, fmt.Sprintf("%v is too few, rolling 1.", numDice))
+		numDice = 1
+	}
+
+	return numDice, notes
+}
+
+// clampRepeats - Turn a repeat count match into the number of times rolled,
+// adding a note if it had to be changed.
+func clampRepeats(countMatch string, notes []string) (int, []string) {
+	count, _ := strconv.Atoi(countMatch)
+	if count > maxRepeats {
+		notes = append(notes, fmt.Sprintf("%v times is too many, rolling %v times.", count, maxRepeats))
+		count = maxRepeats
+	}
+	if count < 1 {
+		notes = append(notes, fmt.Sprintf("%v times is too few, rolling once.", count))
+		count = 1
+	}
+
+	return count, notes
+}
+
+// oneSided - Is this a one-sided die? Those can't be rolled; they roll off
+// into the shadows. (Other dice with fewer than 2 sides are rolled as d2.)
+func oneSided(sides string) bool {
+	return sides == "1"
+}
+
+// clampSides - Turn the num_sides match into the sides RollDice() rolls: "%",
+// "F", or a number from 2 to maxSides, adding a note if it had to be cut down.
+func clampSides(sides string, notes []string) (string, []string) {
+	if sides == "%" || sides == "F" {
+		return sides, notes
+	}
+
+	// Atoi gives the largest int for numbers that don't fit, which is too many
+	// anyway.
+	value, _ := strconv.Atoi(sides)
+	if value > maxSides {
+		notes = append(notes, fmt.Sprintf("%v sides is too many, rolling d%v.", sides, maxSides))
+		value = maxSides
+	}
+	if value < 2 {
+		value = 2
+	}
+
+	return strconv.Itoa(value), notes
 }
 
 // RollDice - Roll {dice}d{sides}{modifier}{modifier_value}.
@@ -121,10 +527,8 @@ func (p *RollyPlugin) RollDice(dice int, sides string, modifier string, modifier
 	} else if sides == "F" {
 		dieSides = 3
 	} else {
-		dieSides, _ = strconv.Atoi(sides)
-		if dieSides < 2 {
-			dieSides = 2
-		}
+		clamped, _ := clampSides(sides, nil)
+		dieSides, _ = strconv.Atoi(clamped)
 	}
 
 	for idx := 0; idx < dice; idx++ {
@@ -144,12 +548,12 @@ func (p *RollyPlugin) RollDice(dice int, sides string, modifier string, modifier
 		total += modifierValue
 	case "-":
 		total -= modifierValue
-		if total < 1 && sides != "F" {
-			total = 1 // Clamp to 1, unless FUDGE.
+		if sides != "F" {
+			total = int(p.getConfiguration().ClampTotal(float64(total))) // Unless FUDGE.
 		}
 	case "/":
 		if modifierValue > 0 {
-			total /= modifierValue
+			total = int(RoundDivision(float64(total)/float64(modifierValue), p.getConfiguration().DivisionRounding))
 		}
 	case "x", "*":
 		total *= modifierValue
@@ -195,3 +599,184 @@ func (p *RollyPlugin) RollDice(dice int, sides string, modifier string, modifier
 
 	return rolls, total
 }
+
+// poolRules - How a dice pool rolls; see RollPool().
+type poolRules struct {
+	again  int  // Dice this high get another die; 0 turns this off.
+	target int  // Dice this high are successes.
+	rote   bool // Reroll failed dice once.
+	double bool // 10s count twice.
+}
+
+// parsePoolMods - Work out a dice pool's rules from the poolPattern matches,
+// like "e9t7" or "dd" and "rote".
+//
+// Exalted pools (dd) succeed on 7 and don't reroll 10s; everyone else succeeds
+// on 8 and has 10-again. Returns the rules, the modifiers written out with
+// silly values fixed (like "e8t8"), and notes about what was fixed.
+func (p *RollyPlugin) parsePoolMods(matches map[string]string) (poolRules, string, []string) {
+	rules := poolRules{again: 10, target: 8, rote: len(matches["rote"]) > 0}
+	mods := p.poolModPattern.FindAllStringSubmatch(matches["pool_mods"], -1)
+	for _, mod := range mods {
+		if strings.ToLower(mod[1]) == "dd" {
+			rules = poolRules{again: 0, target: 7, rote: rules.rote, double: true}
+		}
+	}
+
+	written := ""
+	var notes []string
+	for _, mod := range mods {
+		name := strings.ToLower(mod[1])
+		value, err := strconv.Atoi(mod[2])
+		switch name {
+		case "e":
+			if err != nil {
+				value = 10
+			}
+			if value < 8 || value > 10 {
+				notes = append(notes, fmt.Sprintf("%v-again isn't a thing, using 8-again.", value))
+				value = 8
+			}
+			rules.again = value
+		case "t":
+			if value < 2 || value > 10 {
+				notes = append(notes, fmt.Sprintf("A target of %v is silly, using 8.", value))
+				value = 8
+			}
+			rules.target = value
+		case "r":
+			rules.rote = true
+		}
+
+		if name == "e" || name == "t" {
+			written += name + strconv.Itoa(value)
+		} else {
+			written += name
+		}
+	}
+
+	return rules, written, notes
+}
+
+// RollPool - Roll a Storyteller-style pool of {dice}d10.
+//
+// Each die that rolls {again} or more gets another die (0 turns this off), and
+// on a rote action each failed die is rerolled once. Dice that roll {target}
+// or more are successes; with {double}, 10s count twice.
+//
+// Returns the chains of rolls (each die followed by its rerolls) and the
+// number of successes.
+func (p *RollyPlugin) RollPool(dice int, again int, target int, rote bool, double bool) ([][]int, int) {
+	var chains [][]int
+
+	rerolls := 0
+	for idx := 0; idx < dice; idx++ {
+		value := p.GetRandom(10)
+		chain := []int{value}
+
+		if rote && value < target {
+			value = p.GetRandom(10)
+			chain = append(chain, value)
+		}
+
+		// Cap the rerolls so 8-again can't run away with us.
+		for again > 0 && value >= again && rerolls < maxDice {
+			value = p.GetRandom(10)
+			chain = append(chain, value)
+			rerolls++
+		}
+
+		chains = append(chains, chain)
+	}
+
+	sort.SliceStable(chains, func(i, j int) bool {
+		return chains[i][0] < chains[j][0]
+	})
+
+	successes := 0
+	for _, chain := range chains {
+		for _, value := range chain {
+			if value >= target {
+				successes++
+				if double && value == 10 {
+					successes++
+				}
+			}
+		}
+	}
+
+	return chains, successes
+}
+
+// FormatChains - Format dice chains like [3 5 9→4 10→10→2].
+func FormatChains(chains [][]int) string {
+	var formatted []string
+	for _, chain := range chains {
+		var values []string
+		for _, value := range chain {
+			values = append(values, strconv.Itoa(value))
+		}
+		formatted = append(formatted, strings.Join(values, "→"))
+	}
+
+	return "[" + strings.Join(formatted, " ") + "]"
+}
+
+// RollFaces - Roll {dice} dice with the given faces.
+//
+// Returns the faces rolled, their total, and whether every face is a number
+// (if not, the total is meaningless). Numeric faces are sorted like RollDice().
+func (p *RollyPlugin) RollFaces(dice int, faces []string) ([]string, int, bool) {
+	var rolled []string
+
+	numeric := true
+	for _, face := range faces {
+		numeric = numeric && isNumber(face)
+	}
+
+	var values []int
+	for idx := 0; idx < dice; idx++ {
+		face := faces[p.GetRandom(len(faces))-1]
+		rolled = append(rolled, face)
+
+		if numeric {
+			value, _ := strconv.Atoi(face)
+			values = append(values, value)
+		}
+	}
+
+	if numeric {
+		sort.Ints(values)
+		for idx, value := range values {
+			rolled[idx] = strconv.Itoa(value)
+		}
+	}
+
+	return rolled, sum(values), numeric
+}
+
+// CountFaces - Count the rolled faces, like "2 hit, 1 miss".
+//
+// The counts are in the same order as the die's faces.
+func CountFaces(rolled []string, faces []string) string {
+	counts := make(map[string]int)
+	for _, face := range rolled {
+		counts[face]++
+	}
+
+	var tally []string
+	for _, face := range faces {
+		if counts[face] > 0 {
+			tally = append(tally, fmt.Sprintf("%d %v", counts[face], face))
+			counts[face] = 0 // Repeated faces only count once.
+		}
+	}
+
+	return strings.Join(tally, ", ")
+}
+
+// Is this face a (possibly negative) number?
+func isNumber(face string) bool {
+	_, err := strconv.Atoi(face)
+	return err == nil
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -17,7 +17,7 @@ func TestHandleRoll(t *testing.T) {
 	p.Init()
 
 	// simplePattern matches
-	rand.Seed(0) // Make these deterministic.
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
 	response := p.HandleRoll("6", "")
 	assert.EqualValues(t, response, `"1d6" = **1**`)
 
@@ -28,7 +28,7 @@ func TestHandleRoll(t *testing.T) {
 	assert.EqualValues(t, response, `"1dF" = **0**`)
 
 	// comboPattern matches
-	rand.Seed(0) // Make these deterministic.
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
 	response = p.HandleRoll("dnd", "")
 	assert.EqualValues(t, response, "D&D standard:\n* 3d6 [1 1 2] = **4**\n* 3d6 [5 5 6] = **16**\n* 3d6 [1 2 6] = **9**\n* 3d6 [1 1 6] = **8**\n* 3d6 [1 1 6] = **8**\n* 3d6 [1 3 6] = **10**")
 
@@ -39,18 +39,18 @@ func TestHandleRoll(t *testing.T) {
 	assert.EqualValues(t, response, "Rolemaster open-ended: 1d% [77] = **77**")
 
 	// rollPattern matches
-	rand.Seed(0) // Make these deterministic.
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
 	response = p.HandleRoll("d3", "")
-	assert.EqualValues(t, response, `"d3" = **1**`)
+	assert.EqualValues(t, response, `"1d3" = **1**`)
 
 	response = p.HandleRoll("2d3", "")
 	assert.EqualValues(t, response, `"2d3" [1 2] = **3**`)
 
 	response = p.HandleRoll("1000d6", "")
-	assert.EqualValues(t, response, "1000 is too many, rolling 100.\n\"1000d6\" [1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 2 2 2 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 4 4 4 4 4 4 4 4 4 4 5 5 5 5 5 5 5 5 5 5 5 5 5 5 5 5 6 6 6 6 6 6 6 6 6 6 6 6 6 6 6] = **320**")
+	assert.EqualValues(t, response, "1000 is too many, rolling 100.\n\"100d6\" [1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 2 2 2 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 3 4 4 4 4 4 4 4 4 4 4 5 5 5 5 5 5 5 5 5 5 5 5 5 5 5 5 6 6 6 6 6 6 6 6 6 6 6 6 6 6 6] = **320**")
 
 	response = p.HandleRoll("6!", "")
-	assert.EqualValues(t, response, "\"6!\" [6 1] = **7**")
+	assert.EqualValues(t, response, "\"1d6!\" [6 1] = **7**")
 
 	response = p.HandleRoll("monkey", "")
 	assert.EqualValues(t, response, "I have no idea what to do with this: monkey")
@@ -60,6 +60,167 @@ func TestHandleRoll(t *testing.T) {
 
 	response = p.HandleRoll("1d1", "")
 	assert.EqualValues(t, response, "Your one-sided die rolls off into the shadows.")
+
+	// poolPattern matches
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response = p.HandleRoll("8d10e9", "")
+	assert.EqualValues(t, response, `"8d10e9" [4 5 5 6 7 7 8 8] = **2 successes**`)
+
+	response = p.HandleRoll("8d10 rote", "")
+	assert.EqualValues(t, response, `"8d10 rote" [1→5 2→1 3→7 8 9 9 9 10→9] = **6 successes**`)
+
+	response = p.HandleRoll("5d10dd", "")
+	assert.EqualValues(t, response, `"5d10dd" [1 2 6 7 9] = **2 successes**`)
+
+	response = p.HandleRoll("3d10t6r", "")
+	assert.EqualValues(t, response, `"3d10t6r" [2→3 3→1 7] = **1 success**`)
+
+	response = p.HandleRoll("8d10e5", "")
+	assert.EqualValues(t, response, "5-again isn't a thing, using 8-again.\n\"8d10e8\" [1 1 5 7 8→9→6 8→5 9→4 10→5] = **5 successes**")
+
+	// d6Pattern matches
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response = p.HandleRoll("d6sys 5D+2", "")
+	assert.EqualValues(t, response, `"d6sys 5D+2" [1 1 2 5] wild [6→5] = **22**`)
+
+	response = p.HandleRoll("d6sys 1D", "")
+	assert.EqualValues(t, response, `"d6sys 1D" wild [2] = **2**`)
+
+	response = p.HandleRoll("d6sys3D-1", "")
+	assert.EqualValues(t, response, "\"d6sys 3D-1\" [1 6] wild [1] = **7**\n⚠️ The wild die rolled a 1: GM's choice of a complication, or dropping the wild die and the highest die for **0**.")
+
+	// facesPattern matches
+	p.setConfiguration(&configuration{CustomDice: "fib=1,1,2,3,5,8; dread=hit,miss,miss"})
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response = p.HandleRoll("2d{1,1,2,3,5,8}", "")
+	assert.EqualValues(t, response, `"2d{1,1,2,3,5,8}" [1 1] = **2**`)
+
+	response = p.HandleRoll("d{-1,0,1}", "")
+	assert.EqualValues(t, response, `"1d{-1,0,1}" = **0**`)
+
+	response = p.HandleRoll("3d{hit,miss}", "")
+	assert.EqualValues(t, response, `"3d{hit,miss}" [hit miss hit] = **2 hit, 1 miss**`)
+
+	response = p.HandleRoll("4d{FIB}", "")
+	assert.EqualValues(t, response, `"4d{FIB}" [1 1 1 8] = **11**`)
+
+	response = p.HandleRoll("d{nope}", "")
+	assert.EqualValues(t, response, "I don't know a custom die called nope.")
+
+	response = p.HandleRoll("d{1,,2}", "")
+	assert.EqualValues(t, response, "I have no idea what to do with this: d{1,,2}")
+
+	// Expressions
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response = p.HandleRoll("5..15", "")
+	assert.EqualValues(t, response, `"5..15" = **8**`)
+
+	response = p.HandleRoll("3d{-3..3}", "")
+	assert.EqualValues(t, response, `"3d{-3..3}" [-3 -1 1] = **-3**`)
+
+	response = p.HandleRoll("d0-9", "")
+	assert.EqualValues(t, response, `"1d0-9" = **5**`)
+
+	response = p.HandleRoll("2d6+5..15", "")
+	assert.EqualValues(t, response, `"2d6+5..15" 2d6 [2 5] + 5..15 [8] = **15**`)
+
+	response = p.HandleRoll("(d{-3..3}+1)*2", "")
+	assert.EqualValues(t, response, `"(1d{-3..3}+1)*2" (1d{-3..3} [0] + 1) * 2 = **2**`)
+
+	response = p.HandleRoll("-2-1d4", "")
+	assert.EqualValues(t, response, `"-2-1d4" -2 - 1d4 [1] = **-3**`)
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response = p.HandleRoll("(1d4)d6", "")
+	assert.EqualValues(t, response, `"(1d4)d6" (1d4 [3])d6 [1 2 5] = **8**`)
+
+	response = p.HandleRoll("2d(1d8)", "")
+	assert.EqualValues(t, response, `"2d(1d8)" 2d(1d8 [4]) [1 4] = **5**`)
+
+	response = p.HandleRoll("1d4/(2-2)", "")
+	assert.EqualValues(t, response, `"1d4/(2-2)" can't be rolled: you can't divide by zero.`)
+
+	// Labels
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response = p.HandleRoll("1d8+3[slashing] + 2d6[fire]", "")
+	assert.EqualValues(t, response, "\"1d8+3[slashing]+2d6[fire]\" 1d8 [3] + 3 *slashing* + 2d6 [1 2] *fire* = **9**\nslashing: **6**, fire: **3**")
+
+	result := p.RollOne("1d20[attack]")
+	assert.EqualValues(t, result.Labels, []RollLabel{{Label: "attack", Total: result.Total}})
+
+	// Huge dice are cut down, whatever the RNG can handle.
+	p = p.WithRNG(NewRNG("pcg", 0))
+	for _, rollArg := range []string{"1d9999999999", "99999999999999999999", "1d9999999999+1", "d(9999999999)"} {
+		result = p.RollOne(rollArg)
+		assert.True(t, result.Total >= 1 && result.Total <= float64(maxSides+1), rollArg)
+		assert.Contains(t, result.Notes[0]+result.Text, "is too many, rolling d1000000.", rollArg)
+	}
+	result = p.RollOne("d{-9223372036854775807..9223372036854775807}")
+	assert.Contains(t, result.Text, "I have no idea what to do with this")
+}
+
+// TestRepeatRoll - Make sure repeated rolls are listed and summed up.
+func TestRepeatRoll(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response := p.HandleRoll("3x 2d6 sort sum", "")
+	assert.EqualValues(t, response, "\"3x 2d6 sort sum\":\n* 2d6 [5 6] = **11**\n* 2d6 [2 5] = **7**\n* 2d6 [1 1] = **2**\nSum: **20**")
+
+	response = p.HandleRoll("{4d6kh3}*3 best 2 worst 1", "")
+	assert.EqualValues(t, response, "\"3x 4d6kh3 best 2 worst 1\":\n* 4d6kh3 [1 1 2 6] = **9**\n* 4d6kh3 [1 1 6 6] = **13**\n* 4d6kh3 [1 1 3 6] = **10**\nBest 2: [13 10] = **23**\nWorst 1: [9] = **9**")
+
+	response = p.HandleRoll("2x 5d10", "")
+	assert.EqualValues(t, response, "\"2x 5d10\":\n* 5d10 [1 5 6 7 9] = **28**\n* 5d10 [1 1 2 3 7] = **14**")
+
+	response = p.HandleRoll("25x 6", "")
+	assert.True(t, strings.HasPrefix(response, "25 times is too many, rolling 20 times.\n\"20x 1d6\":\n* 1d6 = **"))
+	assert.EqualValues(t, strings.Count(response, "\n* "), 20)
+
+	response = p.HandleRoll("0x 6", "")
+	assert.EqualValues(t, strings.Count(response, "\n* "), 1)
+
+	response = p.HandleRoll("2x monkey", "")
+	assert.EqualValues(t, response, "I have no idea what to do with this: monkey")
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response = p.HandleRoll("2x 1d20+5 >= 15", "")
+	assert.EqualValues(t, response, "\"2x 1d20+5 >= 15\":\n* 1d20 [15] + 5 >= 15 = **yes**\n* 1d20 [15] + 5 >= 15 = **yes**")
+}
+
+// TestVsRoll - Make sure one roll is compared against each target.
+func TestVsRoll(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	response := p.HandleRoll("1d20+6 vs 12,15,18", "")
+	assert.EqualValues(t, response, "\"1d20+6 vs 12,15,18\" = **21**\n\n| Target | Result | Margin |\n|---:|:---|---:|\n| 12 | ✅ hit | +9 |\n| 15 | ✅ hit | +6 |\n| 18 | ✅ hit | +3 |")
+
+	response = p.HandleRoll("2d6+1d4 vs 5", "")
+	assert.EqualValues(t, response, "\"2d6+1d4 vs 5\" 2d6 [1 2] + 1d4 [3] = **6**\n\n| Target | Result | Margin |\n|---:|:---|---:|\n| 5 | ✅ hit | +1 |")
+
+	response = p.HandleRoll("monkey vs 3", "")
+	assert.EqualValues(t, response, "I have no idea what to do with this: monkey")
+}
+
+// TestCompareTargets - Make sure hits, misses and margins are right.
+func TestCompareTargets(t *testing.T) {
+	lines := CompareTargets(15, "12, 15,18,-2")
+	assert.EqualValues(t, lines, []string{
+		"",
+		"| Target | Result | Margin |",
+		"|---:|:---|---:|",
+		"| 12 | ✅ hit | +3 |",
+		"| 15 | ✅ hit | +0 |",
+		"| 18 | ❌ miss | -3 |",
+		"| -2 | ✅ hit | +17 |",
+	})
+
+	lines = CompareTargets(10, strings.Repeat("1,", maxTargets)+"1")
+	assert.EqualValues(t, lines[0], "That's too many targets, using the first 20.")
+	assert.EqualValues(t, len(lines), maxTargets+4)
 }
 
 // TestRollDice - Make sure different combinations return correct values.
@@ -68,7 +229,7 @@ func TestRollDice(t *testing.T) {
 	p.Init()
 
 	// Different number of sides.
-	rand.Seed(0) // Make these deterministic.
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
 	rolls, total := p.RollDice(1, "%", "", 0)
 	assert.EqualValues(t, rolls[0], 75)
 	assert.EqualValues(t, total, 75)
@@ -82,14 +243,14 @@ func TestRollDice(t *testing.T) {
 	assert.EqualValues(t, total, 2)
 
 	// Different modifiers.
-	rand.Seed(0) // Make these deterministic.
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
 	rolls, total = p.RollDice(1, "6", "+", 1)
 	assert.EqualValues(t, rolls[0], 1)
 	assert.EqualValues(t, total, 2)
 
 	rolls, total = p.RollDice(1, "6", "-", 6)
 	assert.EqualValues(t, rolls[0], 1)
-	assert.EqualValues(t, total, 1)
+	assert.EqualValues(t, total, -5)
 
 	rolls, total = p.RollDice(1, "6", "/", 2)
 	assert.EqualValues(t, rolls[0], 2)
@@ -99,7 +260,7 @@ func TestRollDice(t *testing.T) {
 	assert.EqualValues(t, rolls[0], 5)
 	assert.EqualValues(t, total, 10)
 
-	rand.Seed(0) // Make these deterministic.
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
 	rolls, total = p.RollDice(2, "6", "<", 1)
 	assert.EqualValues(t, rolls[0], 1)
 	assert.EqualValues(t, rolls[1], 1)
@@ -121,7 +282,7 @@ func TestRollDice(t *testing.T) {
 	assert.EqualValues(t, total, 0)
 
 	// Need to roll these several times before it actually explodes.
-	rand.Seed(0) // Make these deterministic.
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
 	rolls, total = p.RollDice(1, "F", "!", 0)
 	rolls, total = p.RollDice(1, "F", "!", 0)
 	rolls, total = p.RollDice(1, "F", "!", 0)
@@ -131,3 +292,120 @@ func TestRollDice(t *testing.T) {
 	assert.EqualValues(t, rolls[1], 0)
 	assert.EqualValues(t, total, 1)
 }
+
+// TestRollDiceSettings - Make sure negative totals and division follow the
+// settings.
+func TestRollDiceSettings(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p.setConfiguration(&configuration{NegativeTotals: "one", DivisionRounding: "up"})
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	rolls, total := p.RollDice(1, "6", "+", 1)
+	assert.EqualValues(t, rolls[0], 1)
+
+	rolls, total = p.RollDice(1, "6", "-", 6)
+	assert.EqualValues(t, rolls[0], 1)
+	assert.EqualValues(t, total, 1)
+
+	rolls, total = p.RollDice(1, "6", "/", 4)
+	assert.EqualValues(t, rolls[0], 2)
+	assert.EqualValues(t, total, 1)
+
+	// FUDGE dice are supposed to go negative.
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	rolls, total = p.RollDice(1, "F", "-", 1)
+	assert.EqualValues(t, rolls[0], -1)
+	assert.EqualValues(t, total, -2)
+
+	p.setConfiguration(&configuration{NegativeTotals: "zero"})
+	rolls, total = p.RollDice(1, "6", "-", 6)
+	assert.EqualValues(t, total, 0)
+}
+
+// TestRollPool - Make sure the again, rote and double rules work.
+func TestRollPool(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	chains, successes := p.RollPool(4, 10, 8, false, false)
+	assert.EqualValues(t, chains, [][]int{{4}, {5}, {5}, {7}})
+	assert.EqualValues(t, successes, 0)
+
+	// Exalted: 7 is enough.
+	chains, successes = p.RollPool(4, 0, 7, false, true)
+	assert.EqualValues(t, chains, [][]int{{6}, {7}, {8}, {8}})
+	assert.EqualValues(t, successes, 3)
+
+	chains, successes = p.RollPool(4, 10, 8, true, false)
+	assert.EqualValues(t, chains, [][]int{{8}, {9}, {9}, {9}})
+	assert.EqualValues(t, successes, 4)
+
+	// The 10 gets a reroll, and counts twice.
+	chains, successes = p.RollPool(4, 8, 8, false, true)
+	assert.EqualValues(t, chains, [][]int{{1}, {2}, {7}, {10, 9, 3}})
+	assert.EqualValues(t, successes, 3)
+}
+
+// TestParsePoolMods - Make sure pool modifiers are read the same way
+// everywhere.
+func TestParsePoolMods(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	parse := func(rollArg string) (poolRules, string, []string) {
+		return p.parsePoolMods(FindNamedSubstrings(p.poolPattern, rollArg))
+	}
+
+	rules, mods, notes := parse("8d10")
+	assert.Equal(t, rules, poolRules{again: 10, target: 8})
+	assert.Equal(t, mods, "")
+	assert.Empty(t, notes)
+
+	rules, mods, notes = parse("8d10e9t7r")
+	assert.Equal(t, rules, poolRules{again: 9, target: 7, rote: true})
+	assert.Equal(t, mods, "e9t7r")
+	assert.Empty(t, notes)
+
+	// Exalted, whichever order the modifiers are in.
+	rules, _, _ = parse("8d10e9dd")
+	assert.Equal(t, rules, poolRules{again: 9, target: 7, double: true})
+
+	rules, mods, notes = parse("8d10e5t11 rote")
+	assert.Equal(t, rules, poolRules{again: 8, target: 8, rote: true})
+	assert.Equal(t, mods, "e8t8")
+	assert.Equal(t, notes, []string{"5-again isn't a thing, using 8-again.", "A target of 11 is silly, using 8."})
+}
+
+// TestFormatChains - Make sure reroll chains are readable.
+func TestFormatChains(t *testing.T) {
+	assert.EqualValues(t, FormatChains([][]int{}), "[]")
+	assert.EqualValues(t, FormatChains([][]int{{3}, {5}}), "[3 5]")
+	assert.EqualValues(t, FormatChains([][]int{{3}, {10, 10, 2}}), "[3 10→10→2]")
+}
+
+// TestRollFaces - Make sure numeric faces add up and text faces don't.
+func TestRollFaces(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	rolled, total, numeric := p.RollFaces(3, []string{"3", "-1", "2"})
+	assert.EqualValues(t, rolled, []string{"-1", "3", "3"})
+	assert.EqualValues(t, total, 5)
+	assert.True(t, numeric)
+
+	rolled, _, numeric = p.RollFaces(3, []string{"hit", "miss"})
+	assert.EqualValues(t, rolled, []string{"hit", "miss", "hit"})
+	assert.False(t, numeric)
+}
+
+// TestCountFaces - Make sure text faces are tallied in die order.
+func TestCountFaces(t *testing.T) {
+	faces := []string{"hit", "miss", "miss", "crit"}
+
+	assert.EqualValues(t, CountFaces([]string{}, faces), "")
+	assert.EqualValues(t, CountFaces([]string{"miss", "hit", "miss"}, faces), "1 hit, 2 miss")
+	assert.EqualValues(t, CountFaces([]string{"crit"}, faces), "1 crit")
+}
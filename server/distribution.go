@@ -0,0 +1,461 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// -----------------------------------------------------------------------------
+// Probability distributions.
+//
+// A Distribution is the chance of each total a roll can have, worked out
+// exactly instead of by rolling lots of times: sums of dice are convolutions,
+// kept or dropped dice are a dynamic program over the faces, and exploding
+// dice are followed explodeDepth explosions deep (the chance of going deeper
+// than that is next to nothing, and it counts as stopping there).
+// -----------------------------------------------------------------------------
+
+const (
+	explodeDepth    int = 20        // Explosions followed for each die.
+	maxDistribution int = 100000    // Most totals a distribution can have.
+	maxCombineWork  int = 10000000  // Most pairs of totals to combine.
+	maxConvolveWork int = 100000000 // Most pairs of whole totals to add up.
+	maxKeepWork     int = 10000000  // Most steps for working out kept dice.
+)
+
+// errInexact - What can't be worked out exactly.
+var errInexact = errors.New("that's too complicated to work out exactly")
+
+// errTooWide - Dice with too many sides to work out exactly. Like errInexact,
+// they're estimated instead, but charts aren't drawn for them.
+var errTooWide = fmt.Errorf("dice with more than %v sides are too wide to work out exactly", maxDistribution)
+
+// Distribution - The chance of each total.
+type Distribution map[float64]float64
+
+// distributionKey - Round a total so 0.1+0.2 and 0.3 are the same total.
+func distributionKey(value float64) float64 {
+	return math.Round(value*1e9) / 1e9
+}
+
+// ConstantDistribution - Always the same total.
+func ConstantDistribution(value float64) Distribution {
+	return Distribution{distributionKey(value): 1}
+}
+
+// rangeFits - Is a die numbered from low to high small enough to work out
+// exactly? Check this before RangeDistribution(), which would happily build a
+// map with billions of totals.
+func rangeFits(low int, high int) bool {
+	// Unsigned, so the widest ranges don't overflow.
+	return uint64(high)-uint64(low) < uint64(maxDistribution)
+}
+
+// RangeDistribution - One die numbered from low to high.
+func RangeDistribution(low int, high int) Distribution {
+	dist := Distribution{}
+	for value := low; value <= high; value++ {
+		dist[float64(value)] = 1 / float64(high-low+1)
+	}
+
+	return dist
+}
+
+// FacesDistribution - One die with these faces; repeated faces come up more.
+func FacesDistribution(faces []int) Distribution {
+	dist := Distribution{}
+	for _, face := range faces {
+		dist[float64(face)] += 1 / float64(len(faces))
+	}
+
+	return dist
+}
+
+// Values - The totals, smallest first.
+func (d Distribution) Values() []float64 {
+	var values []float64
+	for value := range d {
+		values = append(values, value)
+	}
+	sort.Float64s(values)
+
+	return values
+}
+
+// Min - The smallest total.
+func (d Distribution) Min() float64 {
+	return d.Values()[0]
+}
+
+// Max - The biggest total.
+func (d Distribution) Max() float64 {
+	values := d.Values()
+
+	return values[len(values)-1]
+}
+
+// Mean - The average total.
+func (d Distribution) Mean() float64 {
+	mean := 0.0
+	for value, chance := range d {
+		mean += value * chance
+	}
+
+	return mean
+}
+
+// Variance - How spread out the totals are.
+func (d Distribution) Variance() float64 {
+	mean := d.Mean()
+
+	variance := 0.0
+	for value, chance := range d {
+		variance += (value - mean) * (value - mean) * chance
+	}
+
+	return variance
+}
+
+// StdDev - The standard deviation of the totals.
+func (d Distribution) StdDev() float64 {
+	return math.Sqrt(d.Variance())
+}
+
+// Percentile - The smallest total that at least this percent of rolls are at
+// or below, like 50 for the median.
+func (d Distribution) Percentile(percent float64) float64 {
+	values := d.Values()
+
+	below := 0.0
+	for _, value := range values {
+		below += d[value]
+		if below >= percent/100-1e-9 {
+			return value
+		}
+	}
+
+	return values[len(values)-1]
+}
+
+// AtLeast - The chance of a total of at least target.
+func (d Distribution) AtLeast(target float64) float64 {
+	chance := 0.0
+	for value, p := range d {
+		if value >= target {
+			chance += p
+		}
+	}
+
+	return math.Min(chance, 1)
+}
+
+// Compare - The chance a total is higher than one from another, independent
+// roll, and the chance they're equal.
+func (d Distribution) Compare(other Distribution) (float64, float64) {
+	otherValues := other.Values()
+
+	higher, equal := 0.0, 0.0
+	below, idx := 0.0, 0 // The other's chance of rolling lower, so far.
+	for _, value := range d.Values() {
+		for idx < len(otherValues) && otherValues[idx] < value {
+			below += other[otherValues[idx]]
+			idx++
+		}
+		higher += d[value] * below
+		equal += d[value] * other[value]
+	}
+
+	return math.Min(higher, 1), math.Min(equal, 1)
+}
+
+// Map - Do something to every total.
+func (d Distribution) Map(f func(float64) float64) Distribution {
+	mapped := Distribution{}
+	for value, chance := range d {
+		mapped[distributionKey(f(value))] += chance
+	}
+
+	return mapped
+}
+
+// mix - Add another distribution to this one, weighted by its chance.
+func (d Distribution) mix(other Distribution, weight float64) {
+	for value, chance := range other {
+		d[value] += chance * weight
+	}
+}
+
+// CombineDistributions - Combine the totals of two independent rolls, like
+// f(x, y) = x * y for multiplying them.
+func CombineDistributions(a Distribution, b Distribution, f func(x float64, y float64) float64) (Distribution, error) {
+	if len(a)*len(b) > maxCombineWork {
+		return nil, errInexact
+	}
+
+	combined := Distribution{}
+	for x, chanceX := range a {
+		for y, chanceY := range b {
+			combined[distributionKey(f(x, y))] += chanceX * chanceY
+		}
+	}
+	if len(combined) > maxDistribution {
+		return nil, errInexact
+	}
+
+	return combined, nil
+}
+
+// AddDistributions - The distribution of the sum of two independent rolls.
+//
+// Whole numbers are convolved in slices, which is a lot faster than maps.
+func AddDistributions(a Distribution, b Distribution) (Distribution, error) {
+	aMin, aMax, aWhole := a.span()
+	bMin, bMax, bWhole := b.span()
+	if !aWhole || !bWhole {
+		return CombineDistributions(a, b, func(x float64, y float64) float64 { return x + y })
+	}
+
+	aSize, bSize := int(aMax-aMin)+1, int(bMax-bMin)+1
+	if aSize+bSize-1 > maxDistribution || aSize*bSize > maxConvolveWork {
+		return nil, errInexact
+	}
+
+	aDense, bDense := make([]float64, aSize), make([]float64, bSize)
+	for value, chance := range a {
+		aDense[int(value-aMin)] = chance
+	}
+	for value, chance := range b {
+		bDense[int(value-bMin)] = chance
+	}
+
+	sums := make([]float64, aSize+bSize-1)
+	for i, chanceA := range aDense {
+		if chanceA == 0 {
+			continue
+		}
+		for j, chanceB := range bDense {
+			sums[i+j] += chanceA * chanceB
+		}
+	}
+
+	total := Distribution{}
+	for idx, chance := range sums {
+		if chance > 0 {
+			total[aMin+bMin+float64(idx)] = chance
+		}
+	}
+
+	return total, nil
+}
+
+// span - The smallest and biggest totals, and are they all whole numbers?
+func (d Distribution) span() (float64, float64, bool) {
+	low, high := math.Inf(1), math.Inf(-1)
+	whole := true
+	for value := range d {
+		low, high = math.Min(low, value), math.Max(high, value)
+		whole = whole && value == math.Trunc(value)
+	}
+
+	return low, high, whole
+}
+
+// SumDistribution - The total of count dice like this one.
+func SumDistribution(die Distribution, count int) (Distribution, error) {
+	total := ConstantDistribution(0)
+
+	// Add up powers of two, so 100 dice takes a handful of steps instead of 100.
+	power := die
+	for count > 0 {
+		var err error
+		if count%2 == 1 {
+			if total, err = AddDistributions(total, power); err != nil {
+				return nil, err
+			}
+		}
+
+		count /= 2
+		if count > 0 {
+			if power, err = AddDistributions(power, power); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// KeepDistribution - The total of count dice like this one, keeping or
+// dropping some of them like keptDice().
+//
+// Goes through the faces from the best one for keeping: for each face, some of
+// the dice that are left show it, and the kept ones add to the total.
+func KeepDistribution(die Distribution, count int, keep string, keepCount int) (Distribution, error) {
+	keepCount = min(keepCount, count)
+	if keepCount < 0 {
+		keepCount = 0
+	}
+
+	// Dropping some is keeping the rest.
+	switch keep {
+	case "dh":
+		keep, keepCount = "kl", count-keepCount
+	case "dl":
+		keep, keepCount = "kh", count-keepCount
+	case "kh", "kl":
+	default:
+		return SumDistribution(die, count)
+	}
+	if keepCount == 0 {
+		return ConstantDistribution(0), nil
+	}
+	if keepCount == count {
+		return SumDistribution(die, count)
+	}
+
+	// Up to count+1 dice done and a kept total for each, times the ways the
+	// dice that are left can show each face.
+	faces := die.Values()
+	totals := float64(keepCount)*(faces[len(faces)-1]-faces[0]) + 1
+	if float64(len(faces))*float64(count+1)*totals*float64(count+1)/2 > float64(maxKeepWork) {
+		return nil, errInexact
+	}
+	if keep == "kh" {
+		sort.Sort(sort.Reverse(sort.Float64Slice(faces)))
+	}
+
+	type keepState struct {
+		dice  int     // Dice showing the faces so far.
+		total float64 // Total of the kept ones.
+	}
+
+	states := map[keepState]float64{{0, 0}: 1}
+	left := 1.0 // Chance of the faces not done yet.
+	for idx, face := range faces {
+		// The chance a die that's left shows this face.
+		chance := 1.0
+		if idx < len(faces)-1 {
+			chance = die[face] / left
+		}
+		left -= die[face]
+
+		next := make(map[keepState]float64)
+		for state, stateChance := range states {
+			rest := count - state.dice
+
+			for showing := 0; showing <= rest; showing++ {
+				p := binomial(rest, showing, chance)
+				if p == 0 {
+					continue
+				}
+
+				kept := min(showing, keepCount-state.dice)
+				if kept < 0 {
+					kept = 0
+				}
+				next[keepState{state.dice + showing, distributionKey(state.total + float64(kept)*face)}] += stateChance * p
+			}
+		}
+		states = next
+	}
+
+	kept := Distribution{}
+	for state, chance := range states {
+		if state.dice == count {
+			kept[state.total] += chance
+		}
+	}
+
+	return kept, nil
+}
+
+// binomial - The chance of exactly k of n tries working, if each has chance p.
+func binomial(n int, k int, p float64) float64 {
+	switch {
+	case p <= 0:
+		if k == 0 {
+			return 1
+		}
+		return 0
+	case p >= 1:
+		if k == n {
+			return 1
+		}
+		return 0
+	}
+
+	lnN, _ := math.Lgamma(float64(n + 1))
+	lnK, _ := math.Lgamma(float64(k + 1))
+	lnNK, _ := math.Lgamma(float64(n - k + 1))
+
+	return math.Exp(lnN - lnK - lnNK + float64(k)*math.Log(p) + float64(n-k)*math.Log(1-p))
+}
+
+// ExplodeDistribution - One die that rolls again and adds it whenever it
+// rolls explodeOn.
+func ExplodeDistribution(die Distribution, explodeOn float64) Distribution {
+	// The deepest die doesn't explode; each level above it can.
+	exploded := die
+	for level := 0; level < explodeDepth; level++ {
+		next := Distribution{}
+		for value, chance := range die {
+			if value == explodeOn {
+				next.mix(exploded.Map(func(more float64) float64 { return value + more }), chance)
+			} else {
+				next[value] += chance
+			}
+		}
+		exploded = next
+	}
+
+	return exploded
+}
+
+// PoolDieDistribution - The successes from one die of a Storyteller pool;
+// see RollPool().
+func PoolDieDistribution(again int, target int, rote bool, double bool) Distribution {
+	successes := func(value int) float64 {
+		switch {
+		case double && value == 10 && value >= target:
+			return 2
+		case value >= target:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	// A die that keeps rolling again; the deepest one doesn't.
+	chain := Distribution{}
+	for value := 1; value <= 10; value++ {
+		chain[successes(value)] += 0.1
+	}
+	for level := 0; level < explodeDepth && again > 0; level++ {
+		next := Distribution{}
+		for value := 1; value <= 10; value++ {
+			if value >= again {
+				next.mix(chain.Map(func(more float64) float64 { return successes(value) + more }), 0.1)
+			} else {
+				next[successes(value)] += 0.1
+			}
+		}
+		chain = next
+	}
+
+	// The first roll, which might get rerolled once instead.
+	die := Distribution{}
+	for value := 1; value <= 10; value++ {
+		switch {
+		case rote && value < target:
+			die.mix(chain, 0.1)
+		case again > 0 && value >= again:
+			die.mix(chain.Map(func(more float64) float64 { return successes(value) + more }), 0.1)
+		default:
+			die[successes(value)] += 0.1
+		}
+	}
+
+	return die
+}
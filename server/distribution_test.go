@@ -0,0 +1,183 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Probability distributions.
+// -----------------------------------------------------------------------------
+
+// bruteForce - Work out a distribution by trying every roll of count dice.
+func bruteForce(faces []int, count int, keep string, keepCount int) Distribution {
+	dist := Distribution{}
+	chance := math.Pow(1/float64(len(faces)), float64(count))
+
+	rolls := make([]int, count)
+	var roll func(idx int)
+	roll = func(idx int) {
+		if idx == count {
+			sorted := append([]int{}, rolls...)
+			sort.Ints(sorted)
+			dist[float64(sum(keptDice(sorted, keep, keepCount)))] += chance
+			return
+		}
+		for _, face := range faces {
+			rolls[idx] = face
+			roll(idx + 1)
+		}
+	}
+	roll(0)
+
+	return dist
+}
+
+// assertSameDistribution - Check two distributions match, give or take
+// rounding.
+func assertSameDistribution(t *testing.T, actual Distribution, expected Distribution, msgAndArgs ...interface{}) {
+	assert.EqualValues(t, actual.Values(), expected.Values(), msgAndArgs...)
+	for value, chance := range expected {
+		assert.InDelta(t, actual[value], chance, 1e-12, msgAndArgs...)
+	}
+}
+
+// TestDistribution - Make sure the summaries add up.
+func TestDistribution(t *testing.T) {
+	d6 := RangeDistribution(1, 6)
+	assert.EqualValues(t, d6.Values(), []float64{1, 2, 3, 4, 5, 6})
+	assert.EqualValues(t, d6.Min(), 1)
+	assert.EqualValues(t, d6.Max(), 6)
+	assert.InDelta(t, d6.Mean(), 3.5, 1e-12)
+	assert.InDelta(t, d6.Variance(), 35.0/12, 1e-12)
+	assert.InDelta(t, d6.StdDev(), math.Sqrt(35.0/12), 1e-12)
+	assert.EqualValues(t, d6.Percentile(50), 3)
+	assert.EqualValues(t, d6.Percentile(51), 4)
+	assert.EqualValues(t, d6.Percentile(100), 6)
+	assert.InDelta(t, d6.AtLeast(5), 1.0/3, 1e-12)
+	assert.EqualValues(t, d6.AtLeast(7), 0)
+	assert.InDelta(t, d6.AtLeast(-7), 1, 1e-12)
+
+	assert.EqualValues(t, ConstantDistribution(0.1+0.2), Distribution{0.3: 1})
+	assert.EqualValues(t, FacesDistribution([]int{1, 1, 2, 2}), Distribution{1: 0.5, 2: 0.5})
+	assert.EqualValues(t, d6.Map(func(value float64) float64 { return math.Floor(value / 4) }).Values(), []float64{0, 1})
+}
+
+// TestCompareDistributions - Compare two rolls against every possible pair.
+func TestCompareDistributions(t *testing.T) {
+	sum2d6, _ := SumDistribution(RangeDistribution(1, 6), 2)
+	d12 := RangeDistribution(1, 12)
+	for _, pair := range [][2]Distribution{{sum2d6, d12}, {d12, sum2d6}, {d12, d12}, {ConstantDistribution(3), d12}} {
+		higher, equal := 0.0, 0.0
+		for x, chanceX := range pair[0] {
+			for y, chanceY := range pair[1] {
+				if x > y {
+					higher += chanceX * chanceY
+				} else if x == y {
+					equal += chanceX * chanceY
+				}
+			}
+		}
+
+		actualHigher, actualEqual := pair[0].Compare(pair[1])
+		assert.InDelta(t, actualHigher, higher, 1e-12)
+		assert.InDelta(t, actualEqual, equal, 1e-12)
+	}
+
+	higher, equal := d12.Compare(ConstantDistribution(20))
+	assert.EqualValues(t, higher, 0)
+	assert.EqualValues(t, equal, 0)
+}
+
+// TestSumDistribution - Compare sums with every possible roll.
+func TestSumDistribution(t *testing.T) {
+	sum3d6, err := SumDistribution(RangeDistribution(1, 6), 3)
+	assert.Nil(t, err)
+	assertSameDistribution(t, sum3d6, bruteForce([]int{1, 2, 3, 4, 5, 6}, 3, "", 0))
+	assert.InDelta(t, sum3d6[10], 27.0/216, 1e-12)
+
+	sum5, err := SumDistribution(FacesDistribution([]int{-1, 0, 0, 3}), 5)
+	assert.Nil(t, err)
+	assertSameDistribution(t, sum5, bruteForce([]int{-1, 0, 0, 3}, 5, "", 0))
+
+	none, err := SumDistribution(RangeDistribution(1, 6), 0)
+	assert.Nil(t, err)
+	assert.EqualValues(t, none, Distribution{0: 1})
+
+	// Fractions go the slow way.
+	halves, err := AddDistributions(Distribution{0.5: 0.5, 1: 0.5}, Distribution{0.5: 0.5, 1: 0.5})
+	assert.Nil(t, err)
+	assert.EqualValues(t, halves, Distribution{1: 0.25, 1.5: 0.5, 2: 0.25})
+
+	_, err = SumDistribution(RangeDistribution(1, 100000), 2)
+	assert.EqualValues(t, err, errInexact)
+}
+
+// TestKeepDistribution - Compare kept dice with every possible roll.
+func TestKeepDistribution(t *testing.T) {
+	for _, test := range []struct {
+		faces     []int
+		count     int
+		keep      string
+		keepCount int
+	}{
+		{[]int{1, 2, 3, 4, 5, 6}, 4, "kh", 3},
+		{[]int{1, 2, 3, 4, 5, 6}, 4, "kl", 3},
+		{[]int{1, 2, 3, 4, 5, 6}, 4, "dh", 1},
+		{[]int{1, 2, 3, 4, 5, 6}, 4, "dl", 1},
+		{[]int{1, 2, 3, 4, 5, 6}, 3, "kh", 5},
+		{[]int{1, 2, 3, 4, 5, 6}, 3, "kh", 0},
+		{[]int{1, 2, 3, 4, 5, 6}, 3, "dl", 5},
+		{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, 2, "kh", 1},
+		{[]int{1, 1, 2, 3, 5, 8}, 5, "kh", 2},
+		{[]int{-3, -2, -1, 0, 1, 2, 3}, 5, "kl", 2},
+	} {
+		kept, err := KeepDistribution(FacesDistribution(test.faces), test.count, test.keep, test.keepCount)
+		assert.Nil(t, err)
+		assertSameDistribution(t, kept, bruteForce(test.faces, test.count, test.keep, test.keepCount), "%v", test)
+	}
+
+	// Advantage.
+	kept, _ := KeepDistribution(RangeDistribution(1, 20), 2, "kh", 1)
+	assert.InDelta(t, kept.Mean(), 13.825, 1e-12)
+}
+
+// TestExplodeDistribution - Make sure exploding dice explode.
+func TestExplodeDistribution(t *testing.T) {
+	exploded := ExplodeDistribution(RangeDistribution(1, 6), 6)
+
+	// Nothing ends on a 6, and the mean is 3.5 * 6/5.
+	assert.EqualValues(t, exploded[6], 0)
+	assert.InDelta(t, exploded[5], 1.0/6, 1e-12)
+	assert.InDelta(t, exploded[9], 1.0/36, 1e-12)
+	assert.InDelta(t, exploded.Mean(), 4.2, 1e-9)
+	assert.EqualValues(t, exploded.Max(), 6*explodeDepth+6)
+
+	total := 0.0
+	for _, chance := range exploded {
+		total += chance
+	}
+	assert.InDelta(t, total, 1, 1e-12)
+}
+
+// TestPoolDieDistribution - Make sure pool dice count their successes.
+func TestPoolDieDistribution(t *testing.T) {
+	// No rerolls: 8, 9 or 10.
+	plain := PoolDieDistribution(0, 8, false, false)
+	assert.EqualValues(t, plain.Values(), []float64{0, 1})
+	assert.InDelta(t, plain[1], 0.3, 1e-12)
+
+	// 10-again: each success is worth 1 + 0.1 more dice.
+	assert.InDelta(t, PoolDieDistribution(10, 8, false, false).Mean(), 0.3/0.9, 1e-9)
+
+	// Rote: failures get another go.
+	rote := PoolDieDistribution(0, 8, true, false)
+	assert.InDelta(t, rote[0], 0.49, 1e-12)
+	assert.InDelta(t, rote[1], 0.51, 1e-12)
+
+	// Exalted: 7, 8 or 9 is one success, 10 is two.
+	assert.InDelta(t, PoolDieDistribution(0, 7, false, true).Mean(), 0.5, 1e-12)
+}
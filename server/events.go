@@ -30,8 +30,20 @@ func (p *RollyPlugin) OnActivate() error {
 		p.router.HandleFunc("/"+iconFile, func(w http.ResponseWriter, r *http.Request) {
 			http.ServeFile(w, r, iconPath)
 		})
+		p.router.HandleFunc("/receipts/key", p.ServeReceiptKey)
+		p.router.HandleFunc("/stats/chart.png", p.ServeChart)
 	}
 
+	// The key for signing receipts; rolls just aren't signed without it.
+	if key, err := p.loadReceiptKey(); err != nil {
+		p.API.LogError("Can't load the receipt signing key.", "err", err.Error())
+	} else {
+		p.receiptKey = key
+	}
+
+	// Make sure the dice aren't loaded.
+	p.CheckRNG()
+
 	// Register our command handler.
 	err := p.API.RegisterCommand(p.GetCommand())
 
@@ -62,10 +74,35 @@ func (p *RollyPlugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs)
 		return nil, nil
 	}
 
-	if strings.Contains(args.Command, "help") {
+	command, comment := SplitComment(strings.TrimPrefix(args.Command, "/"+trigger))
+	canonical := p.getConfiguration().ApplyAliases(command)
+	if strings.Contains(canonical, "help") {
 		return p.GetHelp()
 	}
 
+	if fields := strings.Fields(canonical); len(fields) > 0 {
+		switch strings.ToLower(fields[0]) {
+		case "normalize":
+			return p.NormalizeCommand(strings.TrimSpace(canonical[len(fields[0]):]))
+		case "seed":
+			return p.SeedCommand()
+		case "reveal-seed":
+			return p.RevealSeedCommand(args.UserId)
+		case "stats":
+			return p.StatsCommand(strings.TrimSpace(canonical[len(fields[0]):]))
+		case "history":
+			return p.HistoryCommand(args.ChannelId, strings.TrimSpace(canonical[len(fields[0]):]))
+		case "luck":
+			return p.LuckCommand(args.UserId, args.ChannelId, strings.TrimSpace(canonical[len(fields[0]):]))
+		case "compare":
+			return p.CompareCommand(strings.TrimSpace(canonical[len(fields[0]):]))
+		case "selftest":
+			return p.SelfTestCommand(args.UserId, strings.TrimSpace(canonical[len(fields[0]):]))
+		case "verify":
+			return p.VerifyCommand(strings.TrimSpace(canonical[len(fields[0]):]))
+		}
+	}
+
 	// Get the user to we can display the right name.
 	userName, userErr := p.GetName(args.UserId)
 	if userErr != nil {
@@ -74,7 +111,7 @@ func (p *RollyPlugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs)
 
 	responseText := fmt.Sprintf("%s throws the dice…", userName)
 
-	rolls := strings.Fields(args.Command)[1:]
+	rolls := SplitRolls(canonical)
 	if len(rolls) > 10 {
 		rolls = rolls[0:11]
 		responseText += fmt.Sprintf("\n⚠️ %d rolls requested; I'm only doing 10.", len(rolls))
@@ -85,13 +122,46 @@ func (p *RollyPlugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs)
 		responseText += fmt.Sprintf("\n🚫 That accomplished nothing.")
 	} else {
 		rollText := ""
-		for idx := 0; idx < len(rolls); idx++ {
-			rollText += "\n🎲 "
-			rollText = p.HandleRoll(rolls[idx], rollText)
+		if canonical != strings.Join(strings.Fields(command), " ") {
+			// Show what the aliases turned it into.
+			rollText += fmt.Sprintf("Rolling `%v`", canonical)
+		}
+		// Luck is only for showing; it isn't part of the roll.
+		shown := func(results []RollResult) []RollResult { return results }
+		if p.ShowLuck(args.UserId, args.ChannelId) {
+			shown = p.AddLuck
+		}
+
+		var results []RollResult
+		rollID := model.NewId()
+		if p.getConfiguration().ProvablyFair {
+			roller, record, err := p.NewFairStream(args.ChannelId, args.UserId)
+			if err != nil {
+				return nil, err
+			}
+
+			results = roller.RollRequests(rolls)
+			rollID = record.ID
+			record.Rolls = rolls
+			record.Text = FormatResults(results, "")
+			if err := p.SaveFairRoll(record); err != nil {
+				return nil, err
+			}
+
+			rollText += FormatResults(shown(results), "") + fmt.Sprintf("\n🔒 Roll `%v`; check it with `/roll verify %v` once the seed is revealed.", record.ID, record.ID)
+		} else {
+			results = p.NewStream(args.ChannelId).RollRequests(rolls)
+			rollText = FormatResults(shown(results), rollText)
+		}
+
+		if err := p.SaveHistory(results, rollID, userName, args.UserId, args.ChannelId); err != nil {
+			// The roll still counts.
+			p.API.LogWarn("Can't save the roll history.", "err", err.Error())
 		}
 
 		attachments = []*model.SlackAttachment{
 			{
+				Title:      comment,
 				Text:       rollText,
 				Color:      "#76C2AF",
 				Fallback:   "🎲",
@@ -101,6 +171,15 @@ func (p *RollyPlugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs)
 				AuthorLink: repoURI,
 			},
 		}
+
+		if p.getConfiguration().SignRolls && p.receiptKey != nil {
+			attachments[0].Fields = []*model.SlackAttachmentField{
+				{
+					Title: "🧾 Receipts",
+					Value: p.SignResults(results, userName, args.UserId, args.ChannelId),
+				},
+			}
+		}
 	}
 
 	props := map[string]interface{}{
@@ -145,3 +145,78 @@ func TestComboRoll(t *testing.T) {
 	assert.True(t, strings.Contains(resp.Text, "throws the dice…"))
 	assert.True(t, strings.Contains(resp.Attachments[0].Text, "D&D standard:"))
 }
+
+// TestPoolRoll - /roll with a rote dice pool.
+func TestPoolRoll(t *testing.T) {
+	resp, err := runTestPluginCommand(t, "/roll 8d10 rote")
+
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	// Positive tests.
+	assert.True(t, strings.Contains(resp.Text, "throws the dice…"))
+	assert.True(t, strings.Contains(resp.Attachments[0].Text, `"8d10 rote"`))
+	assert.True(t, strings.Contains(resp.Attachments[0].Text, "success"))
+}
+
+// TestD6SystemRoll - /roll with a D6 System roll.
+func TestD6SystemRoll(t *testing.T) {
+	resp, err := runTestPluginCommand(t, "/roll d6sys 5D+2")
+
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	// Positive tests.
+	assert.True(t, strings.Contains(resp.Text, "throws the dice…"))
+	assert.True(t, strings.Contains(resp.Attachments[0].Text, `"d6sys 5D+2"`))
+	assert.True(t, strings.Contains(resp.Attachments[0].Text, "wild"))
+}
+
+// TestConditionalRoll - /roll with a conditional expression that has spaces.
+func TestConditionalRoll(t *testing.T) {
+	resp, err := runTestPluginCommand(t, "/roll 1d20+7 >= 15 ? 2d6+4 : 0")
+
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	// Positive tests.
+	assert.True(t, strings.Contains(resp.Text, "throws the dice…"))
+	assert.True(t, strings.Contains(resp.Attachments[0].Text, `"1d20+7 >= 15 ? 2d6+4 : 0"`))
+	assert.EqualValues(t, strings.Count(resp.Attachments[0].Text, "🎲"), 1)
+}
+
+// TestCommentRoll - /roll with a comment, which could mention help.
+func TestCommentRoll(t *testing.T) {
+	resp, err := runTestPluginCommand(t, "/roll 1d20+5 # help the goblin")
+
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	// Positive tests.
+	assert.True(t, strings.Contains(resp.Text, "throws the dice…"))
+	assert.EqualValues(t, resp.Attachments[0].Title, "help the goblin")
+	assert.True(t, strings.Contains(resp.Attachments[0].Text, `"1d20+5"`))
+}
+
+// TestAliasRoll - /roll with another bot's notation.
+func TestAliasRoll(t *testing.T) {
+	resp, err := runTestPluginCommand(t, "/roll /r [[1d20+5]]")
+
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	// Positive tests.
+	assert.True(t, strings.HasPrefix(resp.Attachments[0].Text, "Rolling `1d20+5`\n🎲 \"1d20+5\""))
+}
+
+// TestNormalizeRoll - /roll normalize shows the rolls without rolling them.
+func TestNormalizeRoll(t *testing.T) {
+	resp, err := runTestPluginCommand(t, "/roll normalize 6 d3")
+
+	assert.NotNil(t, resp)
+	assert.Nil(t, err)
+
+	// Positive tests.
+	assert.EqualValues(t, resp.Text, "* `6` → `1d6`\n* `d3` → `1d3`")
+	assert.Empty(t, resp.Attachments)
+}
@@ -0,0 +1,1251 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// -----------------------------------------------------------------------------
+// Dice expressions.
+//
+// Anything the regexes in plugin.go don't understand gets parsed as an
+// expression, like "2d6+5..15" or "1d20+7 >= 15 ? 2d6+4 : 0". This is a small
+// recursive-descent parser for this grammar:
+//
+//   expression := comparison ["?" expression ":" expression]
+//   comparison := sum [compare sum | "until" ["total"] [compare] sum]
+//   compare    := ">=" | "<=" | ">" | "<" | "==" | "=" | "!="
+//   sum        := term [label] (("+" | "-") term [label])*
+//   term       := unary (("*" | "x" | "/" | "//" | "/^" | "/~") unary)*
+//   unary      := "-" unary | primary
+//   primary    := range | [count] dice | number | group | function | "nat"
+//   function   := name "(" expression ("," expression)* ")"
+//   group      := "(" expression ")"
+//   count      := number | group
+//   dice       := "d" (sides | "%" | "F" | "0-" number | "{" faces "}") [keep number]
+//   sides      := number | group
+//   faces      := range | name | face ("," face)*
+//   range      := ["-"] number ".." ["-"] number
+//   keep       := "kh" | "kl" | "dh" | "dl"
+//   label      := "[" text "]"
+//
+// Values are float64 so functions like floor() have something to do; "/"
+// rounds the way the DivisionRounding setting says, while "//", "/^" and "/~"
+// always round down, up, or to the nearest. Dice can keep the highest or
+// lowest few, or drop them, like "4d6kh3". Comparisons are yes (1) or no (0),
+// and "nat" is the first die rolled, so "nat == 20" spots a natural 20.
+//
+// "until" rolls the same thing again and again until it (or the running total)
+// passes the test, like "1d6 until 6" or "1d6 until total > 20", and is worth
+// the number of attempts it took; maxAttempts keeps it from going forever.
+//
+// A label names the terms since the last one, so "1d8+3[slashing] + 2d6[fire]"
+// adds up the slashing and fire separately as well as together.
+// -----------------------------------------------------------------------------
+
+const maxExpressionDice int = 1000 // Most dice we'll roll for one expression.
+const maxAttempts int = 100        // Most times "until" will roll something.
+
+// Symbols, longest first so ".." isn't read as two of something.
+var exprSymbols = []string{"..", "//", "/^", "/~", ">=", "<=", "==", "!=", "+", "-", "*", "/", "(", ")", "{", "}", ",", "%", ">", "<", "=", "?", ":"}
+
+// Comparison operators.
+var comparisons = []string{">=", "<=", ">", "<", "==", "=", "!="}
+
+// Division operators, and how they round.
+var divisionRounding = map[string]string{
+	"//": "down",
+	"/^": "up",
+	"/~": "nearest",
+}
+
+// Functions, and how many arguments they need (0 for "at least one").
+var exprFunctions = map[string]int{
+	"floor": 1,
+	"ceil":  1,
+	"round": 1,
+	"abs":   1,
+	"min":   0,
+	"max":   0,
+}
+
+// Ways to keep or drop some of the dice, like "4d6kh3".
+var keepModes = []string{"kh", "kl", "dh", "dl"}
+
+// Token kinds.
+const (
+	tokenEnd = iota
+	tokenNumber
+	tokenDecimal
+	tokenWord
+	tokenSymbol
+	tokenLabel // The text is what's inside the brackets.
+)
+
+type token struct {
+	kind    int
+	text    string
+	value   int     // For tokenNumber.
+	decimal float64 // For tokenDecimal.
+}
+
+// exprNode - One piece of a parsed expression.
+type exprNode interface {
+	// roll - Work out the value, rolling any dice along the way.
+	roll(ctx *exprContext) (exprResult, error)
+
+	// format - Write it out the way it gets rolled, like "1d20+5".
+	format() string
+
+	// distribution - Work out the chance of each value; see stats.go.
+	distribution(ctx *exprContext) (Distribution, error)
+}
+
+// exprContext - State for rolling one expression.
+type exprContext struct {
+	p       *RollyPlugin
+	dice    int         // Dice rolled so far.
+	natural []int       // The first die rolled, once there is one.
+	notes   []string    // Complaints, like "1000 is too many, rolling 100."
+	labels  []RollLabel // Totals for each label so far.
+	crit    string      // For critical damage, "double" or "max" the dice.
+
+	// The sum so far at each label, so the next one knows where its terms
+	// start.
+	labelSums map[*labelNode]float64
+}
+
+// exprResult - The value of (part of) an expression, and how we got there.
+type exprResult struct {
+	value  float64
+	detail string      // Like "2d6 [3 4] + 5".
+	rolls  []int       // Dice rolled, if this is a dice term.
+	isBool bool        // Is this the yes (1) or no (0) from a comparison?
+	labels []RollLabel // Totals for each label, for the whole expression.
+}
+
+// ParseExpression - Parse a dice expression.
+func (p *RollyPlugin) ParseExpression(expr string) (exprNode, error) {
+	tokens, err := lexExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &exprParser{p: p, tokens: tokens}
+	node, err := parser.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if parser.peek().kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %v", parser.peek().text)
+	}
+
+	return node, nil
+}
+
+// RollExpression - Roll a parsed expression.
+//
+// Returns the result, and any notes about adjustments made along the way.
+func (p *RollyPlugin) RollExpression(node exprNode) (exprResult, []string, error) {
+	return p.rollExpression(node, "")
+}
+
+// rollExpression - Roll a parsed expression, maybe as a critical hit.
+func (p *RollyPlugin) rollExpression(node exprNode, crit string) (exprResult, []string, error) {
+	ctx := &exprContext{p: p, crit: crit}
+
+	result, err := node.roll(ctx)
+	result.labels = ctx.labels
+
+	return result, ctx.notes, err
+}
+
+// lexExpression - Split an expression into tokens.
+func lexExpression(expr string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(expr)
+	for idx := 0; idx < len(runes); {
+		r := runes[idx]
+
+		switch {
+		case unicode.IsSpace(r):
+			idx++
+		case r >= '0' && r <= '9':
+			start := idx
+			for idx < len(runes) && runes[idx] >= '0' && runes[idx] <= '9' {
+				idx++
+			}
+
+			// A decimal point has to have digits after it, or it's a range.
+			if idx+1 < len(runes) && runes[idx] == '.' && runes[idx+1] >= '0' && runes[idx+1] <= '9' {
+				idx++
+				for idx < len(runes) && runes[idx] >= '0' && runes[idx] <= '9' {
+					idx++
+				}
+
+				text := string(runes[start:idx])
+				decimal, _ := strconv.ParseFloat(text, 64)
+				tokens = append(tokens, token{kind: tokenDecimal, text: text, decimal: decimal})
+				break
+			}
+
+			text := string(runes[start:idx])
+			value, err := strconv.Atoi(text)
+			if err != nil {
+				return nil, fmt.Errorf("%v is too big", text)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: value})
+		case r == '[':
+			start := idx + 1
+			for idx < len(runes) && runes[idx] != ']' {
+				idx++
+			}
+			if idx == len(runes) {
+				return nil, errors.New("there's a [ without a ]")
+			}
+
+			label := strings.TrimSpace(string(runes[start:idx]))
+			if label == "" {
+				return nil, errors.New("there's an empty label")
+			}
+			tokens = append(tokens, token{kind: tokenLabel, text: label})
+			idx++
+		case unicode.IsLetter(r):
+			start := idx
+			for idx < len(runes) && unicode.IsLetter(runes[idx]) {
+				idx++
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, text: strings.ToLower(string(runes[start:idx]))})
+		default:
+			symbol := ""
+			for _, candidate := range exprSymbols {
+				if strings.HasPrefix(string(runes[idx:]), candidate) {
+					symbol = candidate
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, fmt.Errorf("unexpected %v", string(r))
+			}
+
+			tokens = append(tokens, token{kind: tokenSymbol, text: symbol})
+			idx += len([]rune(symbol))
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd, text: "end of roll"}), nil
+}
+
+// -----------------------------------------------------------------------------
+// Parser.
+// -----------------------------------------------------------------------------
+
+type exprParser struct {
+	p      *RollyPlugin
+	tokens []token
+	pos    int
+}
+
+// Look at the token n past the current one (the end token repeats forever).
+func (ep *exprParser) peekAt(n int) token {
+	if ep.pos+n >= len(ep.tokens) {
+		return ep.tokens[len(ep.tokens)-1]
+	}
+
+	return ep.tokens[ep.pos+n]
+}
+
+func (ep *exprParser) peek() token {
+	return ep.peekAt(0)
+}
+
+func (ep *exprParser) next() token {
+	tok := ep.peek()
+	if ep.pos < len(ep.tokens)-1 {
+		ep.pos++
+	}
+
+	return tok
+}
+
+// Is the current token this symbol or word? If so, skip it.
+func (ep *exprParser) accept(text string) bool {
+	tok := ep.peek()
+	if (tok.kind == tokenWord || tok.kind == tokenSymbol) && tok.text == text {
+		ep.next()
+		return true
+	}
+
+	return false
+}
+
+func (ep *exprParser) expect(text string) error {
+	if !ep.accept(text) {
+		return fmt.Errorf("expected %v but found %v", text, ep.peek().text)
+	}
+
+	return nil
+}
+
+func (ep *exprParser) expectNumber() (int, error) {
+	tok := ep.next()
+	if tok.kind != tokenNumber {
+		return 0, fmt.Errorf("expected a number but found %v", tok.text)
+	}
+
+	return tok.value, nil
+}
+
+// Is there a range (like "5..15" or "-3..3") coming up?
+func (ep *exprParser) atRange() bool {
+	if ep.peek().text == "-" && ep.peekAt(1).kind == tokenNumber {
+		return ep.peekAt(2).text == ".."
+	}
+
+	return ep.peek().kind == tokenNumber && ep.peekAt(1).text == ".."
+}
+
+func (ep *exprParser) parseSigned() (int, error) {
+	if ep.accept("-") {
+		value, err := ep.expectNumber()
+		return -value, err
+	}
+
+	return ep.expectNumber()
+}
+
+func (ep *exprParser) parseRange() (int, int, error) {
+	low, err := ep.parseSigned()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = ep.expect(".."); err != nil {
+		return 0, 0, err
+	}
+	high, err := ep.parseSigned()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if low > high {
+		low, high = high, low
+	}
+
+	return low, high, checkWidth(low, high)
+}
+
+// checkWidth - Make sure a range isn't too wide to roll, like
+// -9223372036854775807..9223372036854775807.
+func checkWidth(low int, high int) error {
+	// Unsigned, so the widest ranges don't overflow.
+	if uint64(high)-uint64(low) >= uint64(maxSides) {
+		return fmt.Errorf("%d..%d has more than %v numbers", low, high, maxSides)
+	}
+
+	return nil
+}
+
+// expression := comparison ["?" expression ":" expression]
+func (ep *exprParser) parseExpression() (exprNode, error) {
+	condition, err := ep.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ep.accept("?") {
+		return condition, nil
+	}
+
+	yes, err := ep.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if err = ep.expect(":"); err != nil {
+		return nil, err
+	}
+	no, err := ep.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	return &conditionalNode{condition: condition, yes: yes, no: no}, nil
+}
+
+// comparison := sum [compare sum | "until" ["total"] [compare] sum]
+func (ep *exprParser) parseComparison() (exprNode, error) {
+	left, err := ep.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.accept("until") {
+		node := &untilNode{attempt: left, total: ep.accept("total"), op: ">="}
+		if ep.peek().kind == tokenSymbol && isOneOf(ep.peek().text, comparisons) {
+			node.op = ep.parseCompare()
+		}
+
+		node.target, err = ep.parseSum()
+		if err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	}
+
+	if ep.peek().kind != tokenSymbol || !isOneOf(ep.peek().text, comparisons) {
+		return left, nil
+	}
+
+	op := ep.parseCompare()
+
+	right, err := ep.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	return &comparisonNode{op: op, left: left, right: right}, nil
+}
+
+// compare := ">=" | "<=" | ">" | "<" | "==" | "=" | "!="
+func (ep *exprParser) parseCompare() string {
+	op := ep.next().text
+	if op == "=" {
+		op = "=="
+	}
+
+	return op
+}
+
+// sum := term [label] (("+" | "-") term [label])*
+//
+// A label covers the terms since the last label, each with its own sign, so
+// "1d6[a] - 1 + 2[b]" has b = -1 + 2.
+func (ep *exprParser) parseSum() (exprNode, error) {
+	left, err := ep.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *labelNode // Where the next label's terms start.
+	for {
+		if ep.peek().kind == tokenLabel {
+			label := &labelNode{label: ep.next().text, labeled: left, previous: previous}
+			left, previous = label, label
+		}
+
+		if ep.peek().text != "+" && ep.peek().text != "-" {
+			break
+		}
+		op := ep.next().text
+
+		right, err := ep.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// term := unary (("*" | "x" | "/" | "//" | "/^" | "/~") unary)*
+func (ep *exprParser) parseTerm() (exprNode, error) {
+	left, err := ep.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for isOneOf(ep.peek().text, []string{"*", "x", "/", "//", "/^", "/~"}) {
+		op := ep.next().text
+		if op == "x" {
+			op = "*"
+		}
+
+		right, err := ep.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// unary := "-" unary | primary
+func (ep *exprParser) parseUnary() (exprNode, error) {
+	if !ep.atRange() && ep.accept("-") {
+		operand, err := ep.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &negateNode{operand: operand}, nil
+	}
+
+	return ep.parsePrimary()
+}
+
+// primary := range | [count] dice | number | group | function | "nat"
+func (ep *exprParser) parsePrimary() (exprNode, error) {
+	if ep.peek().kind == tokenDecimal {
+		return &numberNode{value: ep.next().decimal}, nil
+	}
+
+	if ep.accept("nat") {
+		return &naturalNode{}, nil
+	}
+
+	if _, ok := exprFunctions[ep.peek().text]; ok && ep.peek().kind == tokenWord {
+		return ep.parseFunction()
+	}
+
+	if ep.atRange() {
+		low, high, err := ep.parseRange()
+		if err != nil {
+			return nil, err
+		}
+
+		return &diceNode{count: &numberNode{value: 1}, low: low, high: high, bare: true}, nil
+	}
+
+	// The number (or group) might be how many dice to roll.
+	var count exprNode
+	if ep.peek().text == "(" {
+		group, err := ep.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		count = group
+	} else if ep.peek().kind == tokenNumber {
+		count = &numberNode{value: float64(ep.next().value)}
+	}
+
+	if ep.peek().kind == tokenWord && (ep.peek().text == "d" || ep.peek().text == "df") {
+		if count == nil {
+			count = &numberNode{value: 1}
+		}
+
+		return ep.parseDice(count)
+	}
+
+	if count != nil {
+		return count, nil
+	}
+
+	return nil, fmt.Errorf("unexpected %v", ep.peek().text)
+}
+
+// function := name "(" expression ("," expression)* ")"
+func (ep *exprParser) parseFunction() (exprNode, error) {
+	node := &functionNode{name: ep.next().text}
+
+	if err := ep.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		arg, err := ep.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		node.args = append(node.args, arg)
+
+		if !ep.accept(",") {
+			break
+		}
+	}
+	if err := ep.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if wanted := exprFunctions[node.name]; wanted > 0 && len(node.args) != wanted {
+		return nil, fmt.Errorf("%v() takes %v argument", node.name, wanted)
+	}
+
+	return node, nil
+}
+
+// group := "(" expression ")"
+func (ep *exprParser) parseGroup() (exprNode, error) {
+	if err := ep.expect("("); err != nil {
+		return nil, err
+	}
+
+	inner, err := ep.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if err = ep.expect(")"); err != nil {
+		return nil, err
+	}
+
+	return &groupNode{inner: inner}, nil
+}
+
+// dice := "d" (sides | "%" | "F" | "0-" number | "{" faces "}") [keep number]
+func (ep *exprParser) parseDice(count exprNode) (exprNode, error) {
+	node := &diceNode{count: count}
+
+	switch {
+	case ep.accept("df"):
+		// FUDGE dice.
+		node.low, node.high = -1, 1
+		node.sides = "F"
+	case !ep.accept("d"):
+		return nil, fmt.Errorf("unexpected %v", ep.peek().text)
+	case ep.accept("%"):
+		node.low, node.high = 1, 100
+		node.sides = "%"
+	case ep.accept("{"):
+		if err := ep.parseFaces(node); err != nil {
+			return nil, err
+		}
+	case ep.peek().kind == tokenNumber && ep.peek().value == 0 && ep.peekAt(1).text == "-" && ep.peekAt(2).kind == tokenNumber:
+		// Zero-based dice like d0-9.
+		ep.next()
+		ep.next()
+		node.low, node.high = 0, ep.next().value
+		node.sides = fmt.Sprintf("0-%d", node.high)
+		if err := checkWidth(node.low, node.high); err != nil {
+			return nil, err
+		}
+	case ep.peek().text == "(":
+		// The number of sides is rolled too.
+		group, err := ep.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		node.rolledSides = group
+	default:
+		sides, err := ep.expectNumber()
+		if err != nil {
+			return nil, err
+		}
+		if sides < 2 {
+			sides = 2
+		}
+		if sides > maxSides {
+			sides = maxSides
+		}
+		node.low, node.high = 1, sides
+		node.sides = strconv.Itoa(sides)
+	}
+
+	if ep.peek().kind == tokenWord && isOneOf(ep.peek().text, keepModes) {
+		node.keep = ep.next().text
+
+		keepCount, err := ep.expectNumber()
+		if err != nil {
+			return nil, err
+		}
+		node.keepCount = keepCount
+	}
+
+	return node, nil
+}
+
+// faces := range | name | face ("," face)*
+func (ep *exprParser) parseFaces(node *diceNode) error {
+	if ep.atRange() {
+		low, high, err := ep.parseRange()
+		if err != nil {
+			return err
+		}
+
+		node.low, node.high = low, high
+		node.sides = fmt.Sprintf("{%d..%d}", low, high)
+
+		return ep.expect("}")
+	}
+
+	var faces []string
+	if ep.peek().kind == tokenWord && ep.peekAt(1).text == "}" {
+		// A custom die from the settings.
+		name := ep.next().text
+
+		named, ok := ep.p.getConfiguration().customDice[name]
+		if !ok {
+			return fmt.Errorf("I don't know a custom die called %v", name)
+		}
+		faces = named
+		node.sides = "{" + name + "}"
+	} else {
+		for {
+			tok := ep.peek()
+			if tok.kind == tokenWord {
+				faces = append(faces, ep.next().text)
+			} else {
+				value, err := ep.parseSigned()
+				if err != nil {
+					return err
+				}
+				faces = append(faces, strconv.Itoa(value))
+			}
+
+			if !ep.accept(",") {
+				break
+			}
+		}
+		node.sides = "{" + strings.Join(faces, ",") + "}"
+	}
+
+	for _, face := range faces {
+		value, err := strconv.Atoi(face)
+		if err != nil {
+			return fmt.Errorf("you can't do math with %v", face)
+		}
+		node.faces = append(node.faces, value)
+	}
+
+	return ep.expect("}")
+}
+
+// -----------------------------------------------------------------------------
+// Expression nodes.
+// -----------------------------------------------------------------------------
+
+// numberNode - A plain number.
+type numberNode struct {
+	value float64
+}
+
+func (n *numberNode) roll(ctx *exprContext) (exprResult, error) {
+	return exprResult{value: n.value, detail: FormatValue(n.value)}, nil
+}
+
+// naturalNode - The first die rolled, before any modifiers.
+type naturalNode struct{}
+
+func (n *naturalNode) roll(ctx *exprContext) (exprResult, error) {
+	if len(ctx.natural) == 0 {
+		return exprResult{}, errors.New("nat needs a die rolled before it")
+	}
+
+	value := ctx.natural[0]
+
+	return exprResult{value: float64(value), detail: fmt.Sprintf("nat [%d]", value)}, nil
+}
+
+// comparisonNode - Compare two things, giving yes (1) or no (0).
+type comparisonNode struct {
+	op    string
+	left  exprNode
+	right exprNode
+}
+
+func (n *comparisonNode) roll(ctx *exprContext) (exprResult, error) {
+	left, err := n.left.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+	right, err := n.right.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+
+	result := exprResult{detail: left.detail + " " + n.op + " " + right.detail, isBool: true}
+	if compare(left.value, n.op, right.value) {
+		result.value = 1
+	}
+
+	return result, nil
+}
+
+// compare - Does "left op right" hold?
+func compare(left float64, op string, right float64) bool {
+	switch op {
+	case ">=":
+		return left >= right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case "<":
+		return left < right
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	default:
+		return false
+	}
+}
+
+// untilNode - Roll something until it (or the running total) passes a test.
+type untilNode struct {
+	attempt exprNode
+	op      string
+	target  exprNode
+	total   bool // Test the running total instead of each roll?
+}
+
+func (n *untilNode) roll(ctx *exprContext) (exprResult, error) {
+	target, err := n.target.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+
+	var attempts []string
+	total := 0.0
+	done := false
+	for len(attempts) < maxAttempts && !done {
+		attempt, err := n.attempt.roll(ctx)
+		if err != nil {
+			return exprResult{}, err
+		}
+		attempts = append(attempts, attempt.detail)
+
+		total += attempt.value
+		if n.total {
+			done = compare(total, n.op, target.value)
+		} else {
+			done = compare(attempt.value, n.op, target.value)
+		}
+	}
+
+	test := fmt.Sprintf("until %v %v", n.op, target.detail)
+	if n.total {
+		test = fmt.Sprintf("until total %v %v %v", FormatValue(total), n.op, target.detail)
+	}
+	if !done {
+		ctx.notes = append(ctx.notes, fmt.Sprintf("Gave up after %v attempts.", maxAttempts))
+	}
+
+	noun := "attempts"
+	if len(attempts) == 1 {
+		noun = "attempt"
+	}
+	detail := fmt.Sprintf("%v %v: %d %v", strings.Join(attempts, ", "), test, len(attempts), noun)
+
+	return exprResult{value: float64(len(attempts)), detail: detail}, nil
+}
+
+// conditionalNode - Roll one thing or another, depending on a condition.
+type conditionalNode struct {
+	condition exprNode
+	yes       exprNode
+	no        exprNode
+}
+
+func (n *conditionalNode) roll(ctx *exprContext) (exprResult, error) {
+	condition, err := n.condition.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+
+	// Only the branch taken gets rolled.
+	branch, answer := n.no, "no"
+	if condition.value != 0 {
+		branch, answer = n.yes, "yes"
+	}
+
+	result, err := branch.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+
+	result.detail = condition.detail + " → " + answer + ": " + result.detail
+	result.rolls = nil
+
+	return result, nil
+}
+
+// functionNode - A function like floor() or max().
+type functionNode struct {
+	name string
+	args []exprNode
+}
+
+func (n *functionNode) roll(ctx *exprContext) (exprResult, error) {
+	var values []float64
+	var details []string
+	for _, arg := range n.args {
+		result, err := arg.roll(ctx)
+		if err != nil {
+			return exprResult{}, err
+		}
+
+		values = append(values, result.value)
+		details = append(details, result.detail)
+	}
+
+	result := exprResult{value: values[0], detail: n.name + "(" + strings.Join(details, ", ") + ")"}
+	switch n.name {
+	case "floor":
+		result.value = math.Floor(values[0])
+	case "ceil":
+		result.value = math.Ceil(values[0])
+	case "round":
+		result.value = math.Round(values[0])
+	case "abs":
+		result.value = math.Abs(values[0])
+	case "min":
+		for _, value := range values {
+			result.value = math.Min(result.value, value)
+		}
+	case "max":
+		for _, value := range values {
+			result.value = math.Max(result.value, value)
+		}
+	}
+
+	return result, nil
+}
+
+// groupNode - An expression in parentheses.
+type groupNode struct {
+	inner exprNode
+}
+
+func (n *groupNode) roll(ctx *exprContext) (exprResult, error) {
+	result, err := n.inner.roll(ctx)
+
+	return exprResult{value: result.value, detail: "(" + result.detail + ")", isBool: result.isBool}, err
+}
+
+// negateNode - The negative of something.
+type negateNode struct {
+	operand exprNode
+}
+
+func (n *negateNode) roll(ctx *exprContext) (exprResult, error) {
+	result, err := n.operand.roll(ctx)
+
+	return exprResult{value: -result.value, detail: "-" + result.detail}, err
+}
+
+// binaryNode - Arithmetic on two things.
+type binaryNode struct {
+	op    string
+	left  exprNode
+	right exprNode
+}
+
+func (n *binaryNode) roll(ctx *exprContext) (exprResult, error) {
+	left, err := n.left.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+	right, err := n.right.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+
+	result := exprResult{detail: left.detail + " " + n.op + " " + right.detail}
+	switch n.op {
+	case "+":
+		result.value = left.value + right.value
+	case "-":
+		result.value = left.value - right.value
+	case "*":
+		result.value = left.value * right.value
+	case "/", "//", "/^", "/~":
+		if right.value == 0 {
+			return exprResult{}, errors.New("you can't divide by zero")
+		}
+
+		rounding, ok := divisionRounding[n.op]
+		if !ok {
+			rounding = ctx.p.getConfiguration().DivisionRounding
+		}
+		result.value = RoundDivision(left.value/right.value, rounding)
+	}
+
+	return result, nil
+}
+
+// labelNode - A label on the terms of a sum since the last label, like
+// "2d6[fire]".
+//
+// It holds the whole sum so far; its total is how much that grew since the
+// previous label.
+type labelNode struct {
+	label    string
+	labeled  exprNode
+	previous *labelNode // The last label in the same sum, if any.
+}
+
+func (n *labelNode) roll(ctx *exprContext) (exprResult, error) {
+	result, err := n.labeled.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+
+	value := result.value
+	if n.previous != nil {
+		value -= ctx.labelSums[n.previous]
+	}
+	if ctx.labelSums == nil {
+		ctx.labelSums = make(map[*labelNode]float64)
+	}
+	ctx.labelSums[n] = result.value
+
+	// The same label can turn up more than once, like "1d8[fire] + 1d6[fire]".
+	found := false
+	for idx := range ctx.labels {
+		if ctx.labels[idx].Label == n.label {
+			ctx.labels[idx].Total += value
+			found = true
+		}
+	}
+	if !found {
+		ctx.labels = append(ctx.labels, RollLabel{Label: n.label, Total: value})
+	}
+
+	result.detail += " *" + n.label + "*"
+	result.rolls = nil
+
+	return result, nil
+}
+
+// diceNode - Some dice, numbered low to high, or with the listed faces.
+type diceNode struct {
+	count       exprNode
+	low         int
+	high        int
+	faces       []int    // Used instead of low/high if set.
+	sides       string   // How to write the sides, like "6", "%" or "{-3..3}".
+	rolledSides exprNode // Used instead of low/high if set, like "d(1d8)".
+	bare        bool     // A range like "5..15" instead of dice.
+	keep        string   // One of keepModes, if only some dice count.
+	keepCount   int      // How many dice to keep or drop.
+}
+
+// isSimple - Are the count and sides just numbers?
+func (n *diceNode) isSimple() bool {
+	_, literal := n.count.(*numberNode)
+
+	return literal && n.rolledSides == nil
+}
+
+func (n *diceNode) roll(ctx *exprContext) (exprResult, error) {
+	// The limits apply after any inner rolls, so (1d4)d6 can't sneak past.
+	countResult, err := n.count.roll(ctx)
+	if err != nil {
+		return exprResult{}, err
+	}
+	count := int(math.Floor(countResult.value))
+	if count > maxDice {
+		ctx.notes = append(ctx.notes, fmt.Sprintf("%v is too many, rolling %v.", count, maxDice))
+		count = maxDice
+	}
+	if count < 1 {
+		ctx.notes = append(ctx.notes, fmt.Sprintf("%v is too few, rolling 1.", count))
+		count = 1
+	}
+
+	low, high, sides := n.low, n.high, n.sides
+	if n.rolledSides != nil {
+		sidesResult, err := n.rolledSides.roll(ctx)
+		if err != nil {
+			return exprResult{}, err
+		}
+
+		low, high, sides = 1, int(math.Floor(sidesResult.value)), sidesResult.detail
+		if high < 2 {
+			ctx.notes = append(ctx.notes, fmt.Sprintf("%v sides is too few, rolling d2.", high))
+			high = 2
+		}
+		if high > maxSides {
+			ctx.notes = append(ctx.notes, fmt.Sprintf("%v sides is too many, rolling d%v.", high, maxSides))
+			high = maxSides
+		}
+	}
+
+	if ctx.crit == "double" && !n.bare {
+		count *= 2
+	}
+
+	ctx.dice += count
+	if ctx.dice > maxExpressionDice {
+		return exprResult{}, fmt.Errorf("that's more than %v dice", maxExpressionDice)
+	}
+
+	var rolls []int
+	for idx := 0; idx < count; idx++ {
+		if len(n.faces) > 0 {
+			rolls = append(rolls, n.faces[ctx.p.GetRandom(len(n.faces))-1])
+		} else {
+			rolls = append(rolls, low+ctx.p.GetRandom(high-low+1)-1)
+		}
+	}
+	if len(ctx.natural) == 0 {
+		ctx.natural = []int{rolls[0]}
+	}
+	sort.Ints(rolls)
+
+	name := fmt.Sprintf("%dd%v", count, sides)
+	if n.bare {
+		name = fmt.Sprintf("%d..%d", low, high)
+	} else if _, literal := n.count.(*numberNode); !literal {
+		name = fmt.Sprintf("%vd%v", countResult.detail, sides)
+	}
+	if n.keep != "" {
+		name += fmt.Sprintf("%v%d", n.keep, n.keepCount)
+	}
+
+	result := exprResult{value: float64(sum(keptDice(rolls, n.keep, n.keepCount))), detail: fmt.Sprintf("%v %v", name, rolls), rolls: rolls}
+	if ctx.crit == "max" && !n.bare {
+		// The kept dice count again, at their best.
+		best := high
+		if len(n.faces) > 0 {
+			best = n.faces[0]
+			for _, face := range n.faces {
+				if face > best {
+					best = face
+				}
+			}
+		}
+
+		var maxed []int
+		for range keptDice(rolls, n.keep, n.keepCount) {
+			maxed = append(maxed, best)
+		}
+		result.value += float64(sum(maxed))
+		result.detail += fmt.Sprintf(" + crit %v", maxed)
+		result.rolls = nil
+	}
+
+	return result, nil
+}
+
+// keptDice - Which of the (sorted) rolls count for "kh", "kl", "dh" or "dl"?
+func keptDice(rolls []int, keep string, keepCount int) []int {
+	keepCount = min(keepCount, len(rolls))
+	if keepCount < 0 {
+		keepCount = 0
+	}
+
+	switch keep {
+	case "kh":
+		return rolls[len(rolls)-keepCount:]
+	case "kl":
+		return rolls[:keepCount]
+	case "dh":
+		return rolls[:len(rolls)-keepCount]
+	case "dl":
+		return rolls[keepCount:]
+	default:
+		return rolls
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Formatting.
+//
+// Expressions are written out with the defaults filled in and the limits
+// applied, so "d20+5" is "1d20+5" and "1000d6" is "100d6". Sums and products
+// are written without spaces; everything else gets spaces so it's readable.
+// -----------------------------------------------------------------------------
+
+func (n *numberNode) format() string {
+	return FormatValue(n.value)
+}
+
+func (n *naturalNode) format() string {
+	return "nat"
+}
+
+func (n *comparisonNode) format() string {
+	return n.left.format() + " " + n.op + " " + n.right.format()
+}
+
+func (n *untilNode) format() string {
+	test := "until "
+	if n.total {
+		test += "total "
+	}
+
+	return n.attempt.format() + " " + test + n.op + " " + n.target.format()
+}
+
+func (n *conditionalNode) format() string {
+	return n.condition.format() + " ? " + n.yes.format() + " : " + n.no.format()
+}
+
+func (n *functionNode) format() string {
+	var args []string
+	for _, arg := range n.args {
+		args = append(args, arg.format())
+	}
+
+	return n.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (n *groupNode) format() string {
+	return "(" + n.inner.format() + ")"
+}
+
+func (n *negateNode) format() string {
+	return "-" + n.operand.format()
+}
+
+func (n *binaryNode) format() string {
+	return n.left.format() + n.op + n.right.format()
+}
+
+func (n *labelNode) format() string {
+	return n.labeled.format() + "[" + n.label + "]"
+}
+
+func (n *diceNode) format() string {
+	if n.bare {
+		return fmt.Sprintf("%d..%d", n.low, n.high)
+	}
+
+	count := n.count.format()
+	if literal, ok := n.count.(*numberNode); ok {
+		count = strconv.Itoa(clampCount(int(math.Floor(literal.value))))
+	}
+
+	sides := n.sides
+	if n.rolledSides != nil {
+		sides = n.rolledSides.format()
+	}
+
+	keep := ""
+	if n.keep != "" {
+		keep = fmt.Sprintf("%v%d", n.keep, n.keepCount)
+	}
+
+	return count + "d" + sides + keep
+}
+
+// clampCount - Keep a number of dice between 1 and maxDice.
+func clampCount(count int) int {
+	if count > maxDice {
+		return maxDice
+	}
+	if count < 1 {
+		return 1
+	}
+
+	return count
+}
+
+// RoundDivision - Round a quotient "down", "up", to the "nearest", or "none".
+//
+// Anything else rounds down, which is what people usually expect.
+func RoundDivision(value float64, rounding string) float64 {
+	switch rounding {
+	case "up":
+		return math.Ceil(value)
+	case "nearest":
+		return math.Round(value)
+	case "none":
+		return value
+	default:
+		return math.Floor(value)
+	}
+}
+
+// FormatValue - Format a value without pointless decimals, like 3 or 3.33.
+func FormatValue(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
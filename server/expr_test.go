@@ -0,0 +1,376 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Dice expressions.
+// -----------------------------------------------------------------------------
+
+// rollTestExpression - Parse and roll an expression, failing on errors.
+func rollTestExpression(t *testing.T, p *RollyPlugin, expr string) exprResult {
+	node, err := p.ParseExpression(expr)
+	assert.Nil(t, err)
+
+	result, _, err := p.RollExpression(node)
+	assert.Nil(t, err)
+
+	return result
+}
+
+// TestLexExpression - Make sure expressions are split up properly.
+func TestLexExpression(t *testing.T) {
+	tokens, err := lexExpression("2d{-3..3} + 10")
+	assert.Nil(t, err)
+
+	var texts []string
+	for _, tok := range tokens {
+		texts = append(texts, tok.text)
+	}
+	assert.EqualValues(t, texts, []string{"2", "d", "{", "-", "3", "..", "3", "}", "+", "10", "end of roll"})
+	assert.EqualValues(t, tokens[0].kind, tokenNumber)
+	assert.EqualValues(t, tokens[0].value, 2)
+	assert.EqualValues(t, tokens[1].kind, tokenWord)
+	assert.EqualValues(t, tokens[2].kind, tokenSymbol)
+
+	_, err = lexExpression("1d6 & 2")
+	assert.NotNil(t, err)
+
+	_, err = lexExpression("99999999999999999999")
+	assert.NotNil(t, err)
+
+	tokens, err = lexExpression("2d6[ cold iron ]+1")
+	assert.Nil(t, err)
+	assert.EqualValues(t, tokens[3].kind, tokenLabel)
+	assert.EqualValues(t, tokens[3].text, "cold iron")
+	assert.EqualValues(t, tokens[4].text, "+")
+
+	_, err = lexExpression("2d6[fire")
+	assert.NotNil(t, err)
+
+	_, err = lexExpression("2d6[]")
+	assert.NotNil(t, err)
+}
+
+// TestParseExpression - Make sure nonsense is rejected.
+func TestParseExpression(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	for _, expr := range []string{"5..15", "d{-3..3}", "d0-9", "2d6+5..15", "(d{-3..3}+1)*2", "-2-1d4", "4dF", "d%/2", "(1d4)d6", "2d(1d8)"} {
+		_, err := p.ParseExpression(expr)
+		assert.Nil(t, err, expr)
+	}
+
+	for _, expr := range []string{"", "monkey", "2d", "(1d4", "5..", "1d6 2", "d{1,}", "d{hit,miss}", "d{nope}", "2d(", "(1d4)d", "0..1000000", "d0-1000000", "d{-9223372036854775807..9223372036854775807}"} {
+		_, err := p.ParseExpression(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+// TestRollExpression - Make sure expressions add up.
+func TestRollExpression(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	result := rollTestExpression(t, p, "-3..3")
+	assert.EqualValues(t, result.value, 2)
+	assert.EqualValues(t, result.detail, "-3..3 [2]")
+
+	result = rollTestExpression(t, p, "2d0-9*3")
+	assert.EqualValues(t, result.value, 21)
+	assert.EqualValues(t, result.detail, "2d0-9 [3 4] * 3")
+
+	result = rollTestExpression(t, p, "4dF")
+	assert.EqualValues(t, result.value, 1)
+	assert.EqualValues(t, result.rolls, []int{0, 0, 0, 1})
+
+	result = rollTestExpression(t, p, "d%/2")
+	assert.EqualValues(t, result.value, 39)
+	assert.EqualValues(t, result.detail, "1d% [78] / 2")
+
+	// No dice.
+	result = rollTestExpression(t, p, "1-(2-3)")
+	assert.EqualValues(t, result.value, 2)
+	assert.EqualValues(t, result.detail, "1 - (2 - 3)")
+
+	result = rollTestExpression(t, p, "2x3+1")
+	assert.EqualValues(t, result.value, 7)
+
+	// Problems.
+	node, _ := p.ParseExpression("0d6+1")
+	_, notes, err := p.RollExpression(node)
+	assert.Nil(t, err)
+	assert.EqualValues(t, notes, []string{"0 is too few, rolling 1."})
+
+	node, _ = p.ParseExpression("1d6/(1-1)")
+	_, _, err = p.RollExpression(node)
+	assert.EqualValues(t, err.Error(), "you can't divide by zero")
+
+	node, _ = p.ParseExpression("100d6+100d6+100d6+100d6+100d6+100d6+100d6+100d6+100d6+100d6+1d6")
+	_, _, err = p.RollExpression(node)
+	assert.EqualValues(t, err.Error(), "that's more than 1000 dice")
+}
+
+// TestKeepDice - Make sure keeping and dropping dice adds up the right ones.
+func TestKeepDice(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	result := rollTestExpression(t, p, "4d6kh3")
+	assert.EqualValues(t, result.value, 8)
+	assert.EqualValues(t, result.detail, "4d6kh3 [1 1 2 5]")
+
+	result = rollTestExpression(t, p, "4d6kl1")
+	assert.EqualValues(t, result.value, 2)
+
+	result = rollTestExpression(t, p, "4d6dh1")
+	assert.EqualValues(t, result.value, 3)
+
+	result = rollTestExpression(t, p, "4d6dl1")
+	assert.EqualValues(t, result.value, 8)
+
+	result = rollTestExpression(t, p, "2d20kh5")
+	assert.EqualValues(t, result.value, 23)
+
+	result = rollTestExpression(t, p, "(2)d6kh1+1")
+	assert.EqualValues(t, result.value, 6)
+	assert.EqualValues(t, result.detail, "(2)d6kh1 [1 5] + 1")
+
+	_, err := p.ParseExpression("4d6kh")
+	assert.NotNil(t, err)
+}
+
+// TestUntil - Make sure "until" counts attempts and gives up eventually.
+func TestUntil(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	result := rollTestExpression(t, p, "1d6 until 6")
+	assert.EqualValues(t, result.value, 5)
+	assert.EqualValues(t, result.detail, "1d6 [1], 1d6 [1], 1d6 [2], 1d6 [5], 1d6 [6] until >= 6: 5 attempts")
+
+	result = rollTestExpression(t, p, "1d6 until total > 20")
+	assert.EqualValues(t, result.value, 7)
+	assert.EqualValues(t, result.detail, "1d6 [5], 1d6 [2], 1d6 [6], 1d6 [1], 1d6 [1], 1d6 [1], 1d6 [6] until total 22 > 20: 7 attempts")
+
+	result = rollTestExpression(t, p, "(1..3 until 1)*10")
+	assert.EqualValues(t, int(result.value)%10, 0)
+
+	node, _ := p.ParseExpression("2d6 until = 13")
+	result, notes, err := p.RollExpression(node)
+	assert.Nil(t, err)
+	assert.EqualValues(t, result.value, maxAttempts)
+	assert.EqualValues(t, notes, []string{"Gave up after 100 attempts."})
+
+	_, err = p.ParseExpression("1d6 until")
+	assert.NotNil(t, err)
+}
+
+// TestLabels - Make sure labels add up the terms they cover.
+func TestLabels(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	result := rollTestExpression(t, p, "1d8+3[slashing] + 2d6[fire]")
+	assert.EqualValues(t, result.value, 9)
+	assert.EqualValues(t, result.detail, "1d8 [3] + 3 *slashing* + 2d6 [1 2] *fire*")
+	assert.EqualValues(t, result.labels, []RollLabel{{Label: "slashing", Total: 6}, {Label: "fire", Total: 3}})
+
+	result = rollTestExpression(t, p, "1d8[fire] + 1d6[fire] + 2")
+	assert.EqualValues(t, result.labels, []RollLabel{{Label: "fire", Total: result.value - 2}})
+
+	result = rollTestExpression(t, p, "1d4[a] - 1[b]")
+	assert.EqualValues(t, result.labels[1], RollLabel{Label: "b", Total: -1})
+
+	// Each term keeps its own sign.
+	result = rollTestExpression(t, p, "1d4[a] - 1 + 2")
+	assert.EqualValues(t, result.value, result.labels[0].Total+1)
+	assert.EqualValues(t, result.detail, "1d4 ["+FormatValue(result.labels[0].Total)+"] *a* - 1 + 2")
+
+	result = rollTestExpression(t, p, "3[a] - 1 + 2 + 3[b]")
+	assert.EqualValues(t, result.value, 7)
+	assert.EqualValues(t, result.labels, []RollLabel{{Label: "a", Total: 3}, {Label: "b", Total: 4}})
+
+	result = rollTestExpression(t, p, "2d6[a] - 1d4 + 1d6[b]")
+	if assert.Len(t, result.labels, 2) {
+		assert.EqualValues(t, result.labels[0].Total+result.labels[1].Total, result.value)
+		assert.True(t, result.labels[1].Total >= -3 && result.labels[1].Total <= 5)
+	}
+
+	result = rollTestExpression(t, p, "2d6")
+	assert.Empty(t, result.labels)
+
+	_, err := p.ParseExpression("[fire]")
+	assert.NotNil(t, err)
+}
+
+// TestNestedDice - Make sure rolled counts and sides are shown and limited.
+func TestNestedDice(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	result := rollTestExpression(t, p, "(1d4)d6")
+	assert.EqualValues(t, result.value, 8)
+	assert.EqualValues(t, result.detail, "(1d4 [3])d6 [1 2 5]")
+
+	result = rollTestExpression(t, p, "2d(1d8)")
+	assert.EqualValues(t, result.value, 5)
+	assert.EqualValues(t, result.detail, "2d(1d8 [4]) [1 4]")
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	result = rollTestExpression(t, p, "(1d4)d(2d6)+1")
+	assert.EqualValues(t, result.value, 8)
+	assert.EqualValues(t, result.detail, "(1d4 [3])d(2d6 [1 2]) [2 2 3] + 1")
+
+	node, _ := p.ParseExpression("(1-3)d6")
+	result, notes, err := p.RollExpression(node)
+	assert.Nil(t, err)
+	assert.EqualValues(t, result.rolls, []int{2})
+	assert.EqualValues(t, notes, []string{"-2 is too few, rolling 1."})
+
+	node, _ = p.ParseExpression("d(1d2-5)")
+	result, notes, err = p.RollExpression(node)
+	assert.Nil(t, err)
+	assert.EqualValues(t, result.rolls, []int{1})
+	assert.EqualValues(t, notes, []string{"-3 sides is too few, rolling d2."})
+}
+
+// TestExpressionFunctions - Make sure functions and rounding work.
+func TestExpressionFunctions(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	for expr, value := range map[string]float64{
+		"7//2":          3,
+		"7/^2":          4,
+		"7/~2":          4,
+		"(7/2)":         3,
+		"-7/2":          -4,
+		"floor(7.5)":    7,
+		"ceil(7.25)":    8,
+		"round(2.5)":    3,
+		"abs(1-9)":      8,
+		"min(3, 1, 2)":  1,
+		"max(3, 1, 2)":  3,
+		"1.5+1.25":      2.75,
+		"10/3*3":        9,
+		"round(10/3*3)": 9,
+	} {
+		result := rollTestExpression(t, p, expr)
+		assert.EqualValues(t, result.value, value, expr)
+	}
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	result := rollTestExpression(t, p, "max(1d20, 1d20)+5")
+	assert.EqualValues(t, result.value, 20)
+	assert.EqualValues(t, result.detail, "max(1d20 [15], 1d20 [15]) + 5")
+
+	// Keep fractions unless asked.
+	p.setConfiguration(&configuration{DivisionRounding: "none"})
+	result = rollTestExpression(t, p, "10/4")
+	assert.EqualValues(t, result.value, 2.5)
+	result = rollTestExpression(t, p, "floor(10/4)")
+	assert.EqualValues(t, result.value, 2)
+
+	for _, expr := range []string{"floor(1, 2)", "max()", "floor", "1.5d6", "d1.5"} {
+		_, err := p.ParseExpression(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+// TestRoundDivision - Make sure the rounding modes round.
+func TestRoundDivision(t *testing.T) {
+	assert.EqualValues(t, RoundDivision(3.5, "down"), 3)
+	assert.EqualValues(t, RoundDivision(-3.5, "down"), -4)
+	assert.EqualValues(t, RoundDivision(3.5, ""), 3)
+	assert.EqualValues(t, RoundDivision(3.25, "up"), 4)
+	assert.EqualValues(t, RoundDivision(3.5, "nearest"), 4)
+	assert.EqualValues(t, RoundDivision(3.25, "nearest"), 3)
+	assert.EqualValues(t, RoundDivision(3.25, "none"), 3.25)
+}
+
+// TestFormatValue - Make sure values look like numbers people write.
+func TestFormatValue(t *testing.T) {
+	assert.EqualValues(t, FormatValue(3), "3")
+	assert.EqualValues(t, FormatValue(-3), "-3")
+	assert.EqualValues(t, FormatValue(2.5), "2.5")
+	assert.EqualValues(t, FormatValue(10.0/3), "3.33")
+}
+
+// TestConditionals - Make sure comparisons and conditionals pick the right
+// branch.
+func TestConditionals(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	for expr, value := range map[string]float64{
+		"3 >= 3":           1,
+		"3 <= 2":           0,
+		"3 > 2":            1,
+		"3 < 2":            0,
+		"3 == 3":           1,
+		"3 = 4":            0,
+		"3 != 4":           1,
+		"(2 > 1) * 5":      5,
+		"1 > 2 ? 10 : 20":  20,
+		"2 > 1 ? 10 : 20":  10,
+		"0 ? 1 : 2 ? 3: 4": 3,
+	} {
+		result := rollTestExpression(t, p, expr)
+		assert.EqualValues(t, result.value, value, expr)
+	}
+
+	result := rollTestExpression(t, p, "3 > 2")
+	assert.True(t, result.isBool)
+	result = rollTestExpression(t, p, "(3 > 2)")
+	assert.True(t, result.isBool)
+	result = rollTestExpression(t, p, "3 + 2")
+	assert.False(t, result.isBool)
+
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+	result = rollTestExpression(t, p, "1d20+7 >= 15 ? 2d6+4 : 0")
+	assert.EqualValues(t, result.value, 7)
+	assert.EqualValues(t, result.detail, "1d20 [15] + 7 >= 15 → yes: 2d6 [1 2] + 4")
+
+	// nat is the first die rolled.
+	result = rollTestExpression(t, p, "2d20 >= 10 ? nat : -nat")
+	assert.EqualValues(t, result.value, 7)
+	assert.EqualValues(t, result.detail, "2d20 [7 16] >= 10 → yes: nat [7]")
+
+	// A natural 20, every time.
+	result = rollTestExpression(t, p, "1d{20}+7 >= 15 ? (nat == 20 ? 4d{6}+4 : 2d{6}+4) : 0")
+	assert.EqualValues(t, result.value, 28)
+	assert.EqualValues(t, result.detail, "1d{20} [20] + 7 >= 15 → yes: (nat [20] == 20 → yes: 4d{6} [6 6 6 6] + 4)")
+
+	node, _ := p.ParseExpression("nat + 1d6")
+	_, _, err := p.RollExpression(node)
+	assert.EqualValues(t, err.Error(), "nat needs a die rolled before it")
+
+	for _, expr := range []string{"1 ? 2", "1 ?? 2", "1 < 2 < 3", "1 ? 2 : "} {
+		_, err := p.ParseExpression(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+// TestCustomDiceExpression - Make sure named dice work in expressions.
+func TestCustomDiceExpression(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+	p.setConfiguration(&configuration{CustomDice: "zero=0,0; dread=hit,miss"})
+
+	result := rollTestExpression(t, p, "2d{zero}+1")
+	assert.EqualValues(t, result.value, 1)
+	assert.EqualValues(t, result.detail, "2d{zero} [0 0] + 1")
+
+	_, err := p.ParseExpression("d{dread}+1")
+	assert.EqualValues(t, err.Error(), "you can't do math with hit")
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Provably fair rolls.
+//
+// With the ProvablyFair setting on, the dice come from a server seed whose
+// hash is published (/roll seed) before anyone rolls. Each request rolls with
+// HMAC-SHA256(seed, "channel|user|nonce|block"), so nobody (including Rolly)
+// can pick the numbers after the fact. /roll reveal-seed publishes the seed
+// and starts a new one; after that, anyone can recompute the rolls, and
+// /roll verify does it for them.
+// -----------------------------------------------------------------------------
+
+// KV store keys.
+const (
+	fairStateKey     string = "fair_state"     // The current fairState.
+	fairRollPrefix   string = "fair_roll_"     // + roll ID: a fairRoll.
+	fairRevealPrefix string = "fair_revealed_" // + seed hash: a revealed seed.
+)
+
+// fairState - The seed in use, and how many requests have used it.
+type fairState struct {
+	Seed  string
+	Nonce uint64
+}
+
+// fairRoll - One request's rolls, kept so they can be verified later.
+type fairRoll struct {
+	ID        string
+	SeedHash  string
+	ChannelID string
+	UserID    string
+	Nonce     uint64
+	Rolls     []string // After aliases and die letters, like "2d20kh1".
+	Text      string
+
+	// The settings it was rolled with; older records don't have them.
+	Settings *fairSettings `json:",omitempty"`
+}
+
+// fairSettings - The settings that change how rolls come out, so changing them
+// later doesn't make honest rolls look edited. Aliases and die letters are
+// already applied to the rolls.
+type fairSettings struct {
+	CustomDice       string
+	DivisionRounding string
+	NegativeTotals   string
+	CritMode         string
+}
+
+// newFairSettings - Take a snapshot of the settings that change how rolls come
+// out.
+func newFairSettings(config *configuration) *fairSettings {
+	return &fairSettings{
+		CustomDice:       config.CustomDice,
+		DivisionRounding: config.DivisionRounding,
+		NegativeTotals:   config.NegativeTotals,
+		CritMode:         config.CritMode,
+	}
+}
+
+// apply - Get a copy of the configuration with these settings instead.
+func (s *fairSettings) apply(config *configuration) *configuration {
+	snapshot := *config
+	snapshot.CustomDice = s.CustomDice
+	snapshot.DivisionRounding = s.DivisionRounding
+	snapshot.NegativeTotals = s.NegativeTotals
+	snapshot.CritMode = s.CritMode
+	snapshot.customDice = ParseCustomDice(s.CustomDice)
+
+	return &snapshot
+}
+
+// NewSeed - Make a new server seed.
+func NewSeed() string {
+	var buffer [32]byte
+	if _, err := rand.Read(buffer[:]); err != nil {
+		// There's nothing sensible to fall back to.
+		panic("crypto/rand failed: " + err.Error())
+	}
+
+	return hex.EncodeToString(buffer[:])
+}
+
+// HashSeed - Get the hash of a seed, which is published before it's used.
+func HashSeed(seed string) string {
+	hash := sha256.Sum256([]byte(seed))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// FairRollID - Name a request's rolls, like "1f0c9a2b-17".
+func FairRollID(seedHash string, nonce uint64) string {
+	return seedHash[:8] + "-" + strconv.FormatUint(nonce, 10)
+}
+
+// -----------------------------------------------------------------------------
+// The fair RNG.
+// -----------------------------------------------------------------------------
+
+type fairRNG struct {
+	seed    []byte
+	message string
+	block   uint64
+	buffer  []byte
+}
+
+// NewFairRNG - Make an RNG that's fully determined by the seed, channel, user
+// and nonce.
+//
+// Numbers come from 8 byte big-endian chunks of HMAC-SHA256(seed,
+// "channel|user|nonce|block") with block = 0, 1, 2, ... and anything from the
+// incomplete block at the top of the range is drawn again, like crypto/rand.
+func NewFairRNG(seed string, channelID string, userID string, nonce uint64) RNG {
+	return &fairRNG{
+		seed:    []byte(seed),
+		message: fmt.Sprintf("%v|%v|%v", channelID, userID, nonce),
+	}
+}
+
+// next - Get the next 64 bits.
+func (r *fairRNG) next() uint64 {
+	if len(r.buffer) == 0 {
+		mac := hmac.New(sha256.New, r.seed)
+		fmt.Fprintf(mac, "%v|%v", r.message, r.block)
+		r.buffer = mac.Sum(nil)
+		r.block++
+	}
+
+	value := binary.BigEndian.Uint64(r.buffer)
+	r.buffer = r.buffer[8:]
+
+	return value
+}
+
+func (r *fairRNG) Intn(n int) int {
+	if n <= 0 {
+		panic("invalid argument to Intn")
+	}
+
+	max := uint64(n)
+	limit := ^uint64(0) - (^uint64(0)%max+1)%max
+	for {
+		value := r.next()
+		if value <= limit {
+			return int(value % max)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Keeping track of seeds and rolls.
+// -----------------------------------------------------------------------------
+
+// loadFairState - Get the seed in use, making one if there isn't one yet.
+//
+// Call this with fairLock held.
+func (p *RollyPlugin) loadFairState() (*fairState, *model.AppError) {
+	state := &fairState{}
+
+	data, err := p.API.KVGet(fairStateKey)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		if jsonErr := json.Unmarshal(data, state); jsonErr != nil {
+			return nil, model.NewAppError("loadFairState", "Can't read the fair seed.", nil, jsonErr.Error(), 0)
+		}
+	}
+
+	if state.Seed == "" {
+		state = &fairState{Seed: NewSeed()}
+		if err := p.saveFairState(state); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// saveFairState - Store the seed in use.
+func (p *RollyPlugin) saveFairState(state *fairState) *model.AppError {
+	data, _ := json.Marshal(state)
+
+	return p.API.KVSet(fairStateKey, data)
+}
+
+// NewFairStream - Get a copy of the plugin that rolls provably fair dice for
+// one request, and a record of the request to fill in and save.
+func (p *RollyPlugin) NewFairStream(channelID string, userID string) (*RollyPlugin, *fairRoll, *model.AppError) {
+	p.fairLock.Lock()
+	defer p.fairLock.Unlock()
+
+	state, err := p.loadFairState()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state.Nonce++
+	if err := p.saveFairState(state); err != nil {
+		return nil, nil, err
+	}
+
+	// The record gets the settings the stream actually rolls with.
+	roller := p.WithRNG(NewFairRNG(state.Seed, channelID, userID, state.Nonce))
+	seedHash := HashSeed(state.Seed)
+	record := &fairRoll{
+		ID:        FairRollID(seedHash, state.Nonce),
+		SeedHash:  seedHash,
+		ChannelID: channelID,
+		UserID:    userID,
+		Nonce:     state.Nonce,
+		Settings:  newFairSettings(roller.getConfiguration()),
+	}
+
+	return roller, record, nil
+}
+
+// SaveFairRoll - Keep a request's rolls so they can be verified later.
+func (p *RollyPlugin) SaveFairRoll(record *fairRoll) *model.AppError {
+	data, _ := json.Marshal(record)
+
+	return p.API.KVSet(fairRollPrefix+record.ID, data)
+}
+
+// -----------------------------------------------------------------------------
+// Commands.
+// -----------------------------------------------------------------------------
+
+// SeedCommand - Publish the hash of the seed in use.
+func (p *RollyPlugin) SeedCommand() (*model.CommandResponse, *model.AppError) {
+	p.fairLock.Lock()
+	defer p.fairLock.Unlock()
+
+	state, err := p.loadFairState()
+	if err != nil {
+		return nil, err
+	}
+
+	text := fmt.Sprintf("🔒 The seed's SHA-256 hash is `%v`, after %d requests.", HashSeed(state.Seed), state.Nonce)
+	if !p.getConfiguration().ProvablyFair {
+		text += "\nProvably fair rolls are turned off, so the seed isn't being used."
+	}
+
+	return fairResponse(text), nil
+}
+
+// RevealSeedCommand - Publish the seed in use, and start a new one, for a
+// System Admin.
+//
+// There's one seed for the whole server, so revealing it ends everyone's
+// session, not just this channel's.
+func (p *RollyPlugin) RevealSeedCommand(userID string) (*model.CommandResponse, *model.AppError) {
+	if !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		response := fairResponse("Only System Admins can reveal the seed, since it's used by every channel.")
+		response.ResponseType = model.COMMAND_RESPONSE_TYPE_EPHEMERAL
+		return response, nil
+	}
+
+	p.fairLock.Lock()
+	defer p.fairLock.Unlock()
+
+	state, err := p.loadFairState()
+	if err != nil {
+		return nil, err
+	}
+
+	seedHash := HashSeed(state.Seed)
+	if err := p.API.KVSet(fairRevealPrefix+seedHash, []byte(state.Seed)); err != nil {
+		return nil, err
+	}
+
+	next := &fairState{Seed: NewSeed()}
+	if err := p.saveFairState(next); err != nil {
+		return nil, err
+	}
+
+	text := fmt.Sprintf("🔓 The seed was `%v` (SHA-256 hash `%v`), used for %d requests.\n🔒 The next seed's hash is `%v`.",
+		state.Seed, seedHash, state.Nonce, HashSeed(next.Seed))
+
+	return fairResponse(text), nil
+}
+
+// VerifyCommand - Roll a request again from its revealed seed, and check it
+// came out the same.
+func (p *RollyPlugin) VerifyCommand(rollID string) (*model.CommandResponse, *model.AppError) {
+	if rollID == "" {
+		return fairResponse("Which roll? Like `/roll verify 1f0c9a2b-17`."), nil
+	}
+
+	data, err := p.API.KVGet(fairRollPrefix + rollID)
+	if err != nil {
+		return nil, err
+	}
+	record := &fairRoll{}
+	if data == nil || json.Unmarshal(data, record) != nil {
+		return fairResponse(fmt.Sprintf("I don't know roll `%v`.", rollID)), nil
+	}
+
+	revealed, err := p.API.KVGet(fairRevealPrefix + record.SeedHash)
+	if err != nil {
+		return nil, err
+	}
+	if revealed == nil {
+		return fairResponse(fmt.Sprintf("Roll `%v` used the seed with hash `%v`, which hasn't been revealed yet. A System Admin can reveal it with `/roll reveal-seed`.",
+			rollID, record.SeedHash)), nil
+	}
+
+	seed := string(revealed)
+	text := fmt.Sprintf("Roll `%v` used seed `%v` (SHA-256 hash `%v`), channel `%v`, user `%v` and nonce %d.",
+		rollID, seed, record.SeedHash, record.ChannelID, record.UserID, record.Nonce)
+	if HashSeed(seed) != record.SeedHash {
+		return fairResponse(text + "\n❌ That seed doesn't match its hash!"), nil
+	}
+
+	roller := p.WithRNG(NewFairRNG(seed, record.ChannelID, record.UserID, record.Nonce))
+	if record.Settings != nil {
+		roller.configuration = record.Settings.apply(roller.getConfiguration())
+	}
+	rerolled := roller.HandleRolls(record.Rolls, "")
+	if rerolled == record.Text {
+		text += "\n✅ Rolling it again gives the same result:" + rerolled
+	} else {
+		text += "\n❌ Rolling it again gives a different result:" + rerolled + "\n\nIt was:" + record.Text
+	}
+
+	return fairResponse(text), nil
+}
+
+// fairResponse - Reply to a command in the channel.
+func fairResponse(text string) *model.CommandResponse {
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_IN_CHANNEL,
+		Text:         strings.TrimSpace(text),
+		Username:     pluginName,
+		IconURL:      iconURI,
+	}
+}
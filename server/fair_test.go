@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Provably fair rolls.
+// -----------------------------------------------------------------------------
+
+// runFairCommand - Run a command on a plugin that keeps its KV store.
+func runFairCommand(t *testing.T, p *RollyPlugin, cmd string) *model.CommandResponse {
+	resp, err := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		Command:   cmd,
+		ChannelId: "channel",
+		UserId:    "userid",
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, resp)
+
+	return resp
+}
+
+// revealSeed - Reveal the seed as a System Admin.
+func revealSeed(t *testing.T, p *RollyPlugin) *model.CommandResponse {
+	resp, err := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{Command: "/roll reveal-seed", UserId: "adminid"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+
+	return resp
+}
+
+// TestSeeds - Make sure seeds are random and hashed.
+func TestSeeds(t *testing.T) {
+	seed := NewSeed()
+	assert.Len(t, seed, 64)
+	assert.NotEqual(t, NewSeed(), seed)
+
+	// Same as "echo -n seed | sha256sum".
+	assert.EqualValues(t, HashSeed("seed"), "19b25856e1c150ca834cffc8b59b23adbd0ec0389e58eb22b3b64768098d002b")
+	assert.EqualValues(t, FairRollID(HashSeed("seed"), 17), "19b25856-17")
+}
+
+// TestFairRNG - Make sure anyone can work out the rolls from the seed.
+func TestFairRNG(t *testing.T) {
+	// The first roll is the first 8 bytes of the first block, as long as it's
+	// not thrown away (which is very unlikely for a d20).
+	mac := hmac.New(sha256.New, []byte("seed"))
+	mac.Write([]byte("channel|user|1|0"))
+	first := int(binary.BigEndian.Uint64(mac.Sum(nil)) % 20)
+
+	rng := NewFairRNG("seed", "channel", "user", 1)
+	assert.EqualValues(t, rng.Intn(20), first)
+
+	// It's the same every time, and different for anything else.
+	rollFair := func(rng RNG) []int {
+		var rolls []int
+		for idx := 0; idx < 20; idx++ {
+			rolls = append(rolls, rng.Intn(1000))
+		}
+		return rolls
+	}
+
+	rolls := rollFair(NewFairRNG("seed", "channel", "user", 1))
+	assert.EqualValues(t, rollFair(NewFairRNG("seed", "channel", "user", 1)), rolls)
+	assert.NotEqual(t, rollFair(NewFairRNG("seed", "channel", "user", 2)), rolls)
+	assert.NotEqual(t, rollFair(NewFairRNG("seed", "other", "user", 1)), rolls)
+	assert.NotEqual(t, rollFair(NewFairRNG("seed", "channel", "other", 1)), rolls)
+	assert.NotEqual(t, rollFair(NewFairRNG("other", "channel", "user", 1)), rolls)
+}
+
+// TestFairRolls - Roll, reveal the seed, and verify the roll.
+func TestFairRolls(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+	p.setConfiguration(&configuration{ProvablyFair: true})
+
+	// The hash is published first.
+	resp := runFairCommand(t, p, "/roll seed")
+	hash := regexp.MustCompile("[0-9a-f]{64}").FindString(resp.Text)
+	assert.True(t, strings.HasPrefix(resp.Text, "🔒 The seed's SHA-256 hash is `"+hash+"`, after 0 requests."))
+
+	resp = runFairCommand(t, p, "/roll 1d20 3d6")
+	assert.Contains(t, resp.Attachments[0].Text, "\n🔒 Roll `"+hash[:8]+"-1`; check it with `/roll verify "+hash[:8]+"-1` once the seed is revealed.")
+	rolled := strings.Split(resp.Attachments[0].Text, "\n🔒")[0]
+
+	// Not yet...
+	resp = runFairCommand(t, p, "/roll verify "+hash[:8]+"-1")
+	assert.EqualValues(t, resp.Text, "Roll `"+hash[:8]+"-1` used the seed with hash `"+hash+"`, which hasn't been revealed yet. A System Admin can reveal it with `/roll reveal-seed`.")
+
+	// Only System Admins can reveal it.
+	resp = runFairCommand(t, p, "/roll reveal-seed")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Only System Admins can reveal the seed, since it's used by every channel.")
+	assert.Contains(t, runFairCommand(t, p, "/roll seed").Text, hash)
+
+	resp = revealSeed(t, p)
+	seed := regexp.MustCompile("`([0-9a-f]{64})`").FindStringSubmatch(resp.Text)[1]
+	assert.EqualValues(t, HashSeed(seed), hash)
+	assert.Contains(t, resp.Text, "used for 1 requests.\n🔒 The next seed's hash is `")
+	assert.NotContains(t, runFairCommand(t, p, "/roll seed").Text, hash)
+
+	// Now anyone can check.
+	resp = runFairCommand(t, p, "/roll verify "+hash[:8]+"-1")
+	assert.EqualValues(t, resp.Text, "Roll `"+hash[:8]+"-1` used seed `"+seed+"` (SHA-256 hash `"+hash+"`), channel `channel`, user `userid` and nonce 1.\n✅ Rolling it again gives the same result:"+rolled)
+
+	roller := p.WithRNG(NewFairRNG(seed, "channel", "userid", 1))
+	assert.EqualValues(t, roller.HandleRolls([]string{"1d20", "3d6"}, ""), rolled)
+
+	// Edited rolls get caught.
+	data, _ := p.API.KVGet(fairRollPrefix + hash[:8] + "-1")
+	record := &fairRoll{}
+	assert.Nil(t, json.Unmarshal(data, record))
+	record.Text = "\n🎲 \"1d20\" = **20**"
+	assert.Nil(t, p.SaveFairRoll(record))
+
+	resp = runFairCommand(t, p, "/roll verify "+hash[:8]+"-1")
+	assert.Contains(t, resp.Text, "\n❌ Rolling it again gives a different result:"+rolled+"\n\nIt was:\n🎲 \"1d20\" = **20**")
+
+	resp = runFairCommand(t, p, "/roll verify nope")
+	assert.EqualValues(t, resp.Text, "I don't know roll `nope`.")
+
+	resp = runFairCommand(t, p, "/roll verify")
+	assert.EqualValues(t, resp.Text, "Which roll? Like `/roll verify 1f0c9a2b-17`.")
+
+	// The roll ID comes from what the aliases turned the command into.
+	p.setConfiguration(&configuration{ProvablyFair: true, Aliases: "check=verify; last=verify " + hash[:8] + "-1"})
+	assert.Contains(t, runFairCommand(t, p, "/roll check "+hash[:8]+"-1").Text, "Roll `"+hash[:8]+"-1` used seed `"+seed+"`")
+	assert.Contains(t, runFairCommand(t, p, "/roll last").Text, "Roll `"+hash[:8]+"-1` used seed `"+seed+"`")
+}
+
+// TestFairRollSettings - Make sure rolls are verified with the settings they
+// were rolled with.
+func TestFairRollSettings(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+	p.setConfiguration(&configuration{ProvablyFair: true, Aliases: "big=d{fib}", CustomDice: "fib=1,1,2,3,5,8",
+		DivisionRounding: "up", NegativeTotals: "one", CritMode: "max"})
+
+	resp := runFairCommand(t, p, "/roll big 1d7/2 1d4-6 damage 1d6 fire crit")
+	hash := regexp.MustCompile("Roll `([0-9a-f]{8})-1`").FindStringSubmatch(resp.Attachments[0].Text)[1]
+
+	data, _ := p.API.KVGet(fairRollPrefix + hash + "-1")
+	record := &fairRoll{}
+	assert.Nil(t, json.Unmarshal(data, record))
+	assert.EqualValues(t, record.Rolls, []string{"d{fib}", "1d7/2", "1d4-6", "damage 1d6 fire crit"})
+	assert.Contains(t, record.Text, "\"1d{fib}\"")
+
+	// Everything changes before the seed is revealed.
+	p.setConfiguration(&configuration{ProvablyFair: true, CustomDice: "fib=0", DivisionRounding: "down", CritMode: "double"})
+	revealSeed(t, p)
+
+	resp = runFairCommand(t, p, "/roll verify "+hash+"-1")
+	assert.Contains(t, resp.Text, "\n✅ Rolling it again gives the same result:"+record.Text)
+}
+
+// TestFairRollsOff - Make sure the seed isn't used unless it's turned on.
+func TestFairRollsOff(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+
+	resp := runFairCommand(t, p, "/roll 1d20")
+	assert.NotContains(t, resp.Attachments[0].Text, "🔒")
+
+	resp = runFairCommand(t, p, "/roll seed")
+	assert.Contains(t, resp.Text, "after 0 requests.\nProvably fair rolls are turned off, so the seed isn't being used.")
+}
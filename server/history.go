@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Roll history.
+//
+// Every roll is kept in the KV store: who rolled what, where and when, and
+// what came up. Each channel has an index of its rolls, oldest first (there's
+// no way to list KV keys), and only the newest HistorySize rolls are kept.
+// "/roll history [@user] [n]" lists the newest ones.
+// -----------------------------------------------------------------------------
+
+// KV store keys.
+const (
+	historyPrefix     string = "history_"      // + channel ID: the IDs of its rolls.
+	historyRollPrefix string = "history_roll_" // + ID: a HistoryEntry.
+)
+
+const (
+	defaultRetention int = 100  // Rolls to keep in each channel.
+	maxRetention     int = 1000 // Most rolls to keep in each channel.
+
+	defaultHistoryShown int = 10 // Rolls to list.
+	maxHistoryShown     int = 50 // Most rolls to list.
+)
+
+// HistoryEntry - One roll, as kept in the history.
+type HistoryEntry struct {
+	ID        string    `json:"id"`
+	RollID    string    `json:"roll_id"` // The request it was part of, like a provably fair roll ID.
+	UserID    string    `json:"user_id"`
+	User      string    `json:"user"`
+	ChannelID string    `json:"channel_id"`
+	Roll      string    `json:"roll"`           // Like "2d6+3".
+	Dice      string    `json:"dice,omitempty"` // The faces that came up, like "[3 4]".
+	Total     float64   `json:"total"`
+	Answer    string    `json:"answer,omitempty"` // Like "10" or "2 successes".
+	Text      string    `json:"text,omitempty"`   // For combos and repeated rolls.
+	Time      time.Time `json:"time"`
+}
+
+// String - Format the entry like
+// "2026-10-18 21:04 UTC, User: "2d6+3" [3 4] = **10**".
+func (e HistoryEntry) String() string {
+	result := RollResult{Roll: e.Roll, Dice: e.Dice, Answer: e.Answer, Text: e.Text}
+	text := result.format(strconv.Quote(e.Roll))
+	if e.Text != "" {
+		text = strconv.Quote(e.Roll) + ": " + text
+	}
+
+	return fmt.Sprintf("%v, %v: %v", e.Time.UTC().Format("2006-01-02 15:04 MST"), e.User, text)
+}
+
+// loadHistoryIndex - Get the IDs of a channel's rolls, oldest first.
+//
+// Call this with historyLock held.
+func (p *RollyPlugin) loadHistoryIndex(channelID string) ([]string, *model.AppError) {
+	var index []string
+
+	data, err := p.API.KVGet(historyPrefix + channelID)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		if jsonErr := json.Unmarshal(data, &index); jsonErr != nil {
+			return nil, model.NewAppError("loadHistoryIndex", "Can't read the roll history.", nil, jsonErr.Error(), 0)
+		}
+	}
+
+	return index, nil
+}
+
+// SaveHistory - Keep a request's rolls in the channel's history, forgetting
+// the oldest ones past HistorySize.
+func (p *RollyPlugin) SaveHistory(results []RollResult, rollID string, userName string, userID string, channelID string) *model.AppError {
+	retention := p.getConfiguration().Retention()
+	if retention == 0 {
+		return nil
+	}
+
+	p.historyLock.Lock()
+	defer p.historyLock.Unlock()
+
+	index, err := p.loadHistoryIndex(channelID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, result := range results {
+		entry := HistoryEntry{
+			ID:        model.NewId(),
+			RollID:    rollID,
+			UserID:    userID,
+			User:      userName,
+			ChannelID: channelID,
+			Roll:      result.Roll,
+			Dice:      result.Dice,
+			Total:     result.Total,
+			Answer:    result.Answer,
+			Text:      result.Text,
+			Time:      now,
+		}
+
+		data, _ := json.Marshal(entry)
+		if err := p.API.KVSet(historyRollPrefix+entry.ID, data); err != nil {
+			return err
+		}
+		index = append(index, entry.ID)
+	}
+
+	for len(index) > retention {
+		if err := p.API.KVDelete(historyRollPrefix + index[0]); err != nil {
+			return err
+		}
+		index = index[1:]
+	}
+
+	data, _ := json.Marshal(index)
+
+	return p.API.KVSet(historyPrefix+channelID, data)
+}
+
+// History - Get the newest count rolls in a channel, oldest first, only by
+// userID if it isn't empty.
+func (p *RollyPlugin) History(channelID string, userID string, count int) ([]HistoryEntry, *model.AppError) {
+	p.historyLock.Lock()
+	defer p.historyLock.Unlock()
+
+	index, err := p.loadHistoryIndex(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []HistoryEntry
+	for idx := len(index) - 1; idx >= 0 && len(entries) < count; idx-- {
+		data, err := p.API.KVGet(historyRollPrefix + index[idx])
+		if err != nil {
+			return nil, err
+		}
+
+		entry := HistoryEntry{}
+		if data == nil || json.Unmarshal(data, &entry) != nil {
+			continue
+		}
+		if userID == "" || entry.UserID == userID {
+			entries = append([]HistoryEntry{entry}, entries...)
+		}
+	}
+
+	return entries, nil
+}
+
+// HistoryCommand - List the newest rolls in the channel, like "@hunter2 5".
+func (p *RollyPlugin) HistoryCommand(channelID string, args string) (*model.CommandResponse, *model.AppError) {
+	response := &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Username:     pluginName,
+		IconURL:      iconURI,
+	}
+
+	if p.getConfiguration().Retention() == 0 {
+		response.Text = "Your System Admin turned off the roll history."
+		return response, nil
+	}
+
+	userID, userName, count := "", "", defaultHistoryShown
+	for _, field := range strings.Fields(args) {
+		if value, err := strconv.Atoi(field); err == nil && value > 0 {
+			count = min(value, maxHistoryShown)
+			continue
+		}
+		if !strings.HasPrefix(field, "@") || userID != "" {
+			response.Text = "Like `/roll history`, `/roll history 20` or `/roll history @someone 5`."
+			return response, nil
+		}
+
+		user, err := p.API.GetUserByUsername(strings.TrimPrefix(field, "@"))
+		if err != nil {
+			response.Text = fmt.Sprintf("I don't know %v.", field)
+			return response, nil
+		}
+		userID, userName = user.Id, field
+	}
+
+	entries, err := p.History(channelID, userID, count)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(entries) == 0 && userID != "":
+		response.Text = fmt.Sprintf("📜 %v hasn't rolled anything in this channel lately.", userName)
+		return response, nil
+	case len(entries) == 0:
+		response.Text = "📜 Nobody has rolled anything in this channel lately."
+		return response, nil
+	}
+
+	title := fmt.Sprintf("📜 The last %v rolls", len(entries))
+	if len(entries) == 1 {
+		title = "📜 The last roll"
+	}
+	if userID != "" {
+		title += " by " + userName
+	}
+	title += " in this channel"
+
+	lines := []string{title + ":"}
+	for _, entry := range entries {
+		lines = append(lines, entry.String())
+	}
+	response.Text = strings.Join(lines, "\n")
+
+	return response, nil
+}
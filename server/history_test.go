@@ -0,0 +1,133 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Roll history.
+// -----------------------------------------------------------------------------
+
+// TestHistorySettings - Make sure the setting is read, or the default used.
+func TestHistorySettings(t *testing.T) {
+	assert.EqualValues(t, (&configuration{}).Retention(), defaultRetention)
+	assert.EqualValues(t, (&configuration{HistorySize: " 20 "}).Retention(), 20)
+	assert.EqualValues(t, (&configuration{HistorySize: "0"}).Retention(), 0)
+	assert.EqualValues(t, (&configuration{HistorySize: "999999"}).Retention(), maxRetention)
+	assert.EqualValues(t, (&configuration{HistorySize: "lots"}).Retention(), defaultRetention)
+	assert.EqualValues(t, (&configuration{HistorySize: "-1"}).Retention(), defaultRetention)
+}
+
+// TestHistory - Make sure rolls are kept, and old ones forgotten.
+func TestHistory(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+	p.setConfiguration(&configuration{HistorySize: "3"})
+
+	results := []RollResult{
+		{Roll: "2d6+3", Dice: "[3 4]", Total: 10, Answer: "10"},
+		{Roll: "dnd", Text: "D&D standard:\n* 3d6 [3 5 5] = **13**"},
+	}
+	assert.Nil(t, p.SaveHistory(results, "request1", "User", "userid", "channel"))
+	assert.Nil(t, p.SaveHistory(results[:1], "request2", "Other", "otherid", "channel"))
+
+	entries, err := p.History("channel", "", 10)
+	assert.Nil(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.EqualValues(t, entries[0].RollID, "request1")
+		assert.EqualValues(t, entries[0].Roll, "2d6+3")
+		assert.EqualValues(t, entries[0].Dice, "[3 4]")
+		assert.EqualValues(t, entries[0].Total, 10)
+		assert.EqualValues(t, entries[0].UserID, "userid")
+		assert.EqualValues(t, entries[0].ChannelID, "channel")
+		assert.Regexp(t, regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{2}:[0-9]{2} UTC, User: "2d6\+3" \[3 4\] = \*\*10\*\*$`), entries[0].String())
+		assert.Regexp(t, regexp.MustCompile(`UTC, User: "dnd": D&D standard:\n\* 3d6 \[3 5 5\] = \*\*13\*\*$`), entries[1].String())
+		assert.EqualValues(t, entries[2].RollID, "request2")
+		assert.EqualValues(t, entries[2].User, "Other")
+	}
+
+	// Newest first, but listed in order.
+	entries, _ = p.History("channel", "", 2)
+	assert.EqualValues(t, []string{entries[0].Roll, entries[1].Roll}, []string{"dnd", "2d6+3"})
+	entries, _ = p.History("channel", "userid", 10)
+	assert.Len(t, entries, 2)
+	entries, _ = p.History("elsewhere", "", 10)
+	assert.Len(t, entries, 0)
+
+	// Only the newest three are kept.
+	oldest, _ := p.loadHistoryIndex("channel")
+	assert.Nil(t, p.SaveHistory(results[:1], "request3", "Other", "otherid", "channel"))
+	index, _ := p.loadHistoryIndex("channel")
+	assert.EqualValues(t, index, append(oldest[1:], index[2]))
+	data, _ := p.API.KVGet(historyRollPrefix + oldest[0])
+	assert.Nil(t, data)
+
+	// Turned off.
+	p.setConfiguration(&configuration{HistorySize: "0"})
+	assert.Nil(t, p.SaveHistory(results, "request4", "User", "userid", "channel"))
+	index, _ = p.loadHistoryIndex("channel")
+	assert.Len(t, index, 3)
+}
+
+// TestHistoryCommand - Make sure rolls show up in the history.
+func TestHistoryCommand(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+
+	run := func(userID string, cmd string) *model.CommandResponse {
+		resp, err := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{Command: cmd, UserId: userID, ChannelId: "channel"})
+		assert.Nil(t, err)
+		return resp
+	}
+
+	assert.EqualValues(t, run("userid", "/roll history").Text, "📜 Nobody has rolled anything in this channel lately.")
+	assert.EqualValues(t, run("userid", "/roll history @hunter2").Text, "📜 @hunter2 hasn't rolled anything in this channel lately.")
+
+	run("userid", "/roll 1d20 2d6")
+	run("otherid", "/roll 3d6")
+
+	resp := run("userid", "/roll history")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.Regexp(t, regexp.MustCompile(`^📜 The last 3 rolls in this channel:
+.+ UTC, User: "1d20" = \*\*[0-9]+\*\*
+.+ UTC, User: "2d6" \[[0-9]+ [0-9]+\] = \*\*[0-9]+\*\*
+.+ UTC, User: "3d6" \[[0-9]+ [0-9]+ [0-9]+\] = \*\*[0-9]+\*\*$`), resp.Text)
+
+	// The mocked users all look the same, but have different IDs.
+	resp = run("otherid", "/roll history 1 @hunter2")
+	assert.Regexp(t, regexp.MustCompile(`^📜 The last roll by @hunter2 in this channel:
+.+ UTC, User: "2d6" .+$`), resp.Text)
+
+	entries, _ := p.History("channel", "", 10)
+	assert.EqualValues(t, entries[0].RollID, entries[1].RollID)
+	assert.NotEqual(t, entries[0].RollID, entries[2].RollID)
+
+	assert.EqualValues(t, run("userid", "/roll history @nobody").Text, "I don't know @nobody.")
+	for _, cmd := range []string{"/roll history monkey", "/roll history @hunter2 @hunter2"} {
+		assert.EqualValues(t, run("userid", cmd).Text, "Like `/roll history`, `/roll history 20` or `/roll history @someone 5`.", cmd)
+	}
+
+	p.setConfiguration(&configuration{HistorySize: "0"})
+	assert.EqualValues(t, run("userid", "/roll history").Text, "Your System Admin turned off the roll history.")
+}
+
+// TestFairHistory - Make sure provably fair rolls are kept with their roll IDs.
+func TestFairHistory(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+	p.setConfiguration(&configuration{ProvablyFair: true})
+
+	resp := runFairCommand(t, p, "/roll 1d20")
+	rollID := regexp.MustCompile("`([0-9a-f]{8}-1)`").FindStringSubmatch(resp.Attachments[0].Text)[1]
+
+	entries, err := p.History("channel", "userid", 10)
+	assert.Nil(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.EqualValues(t, entries[0].RollID, rollID)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Luck.
+//
+// With luck turned on (/roll luck on, or /roll luck channel on for everyone in
+// a channel), each roll says how lucky it was, like "🍀 Top 8% result,
+// expected 10.5", worked out from the exact distribution of what was rolled
+// (see stats.go). This happens for every roll, so rolls that would have to be
+// estimated (including dice too wide to work out exactly), and rolls without a
+// single total, don't say anything.
+//
+// A user's own setting beats the channel's; the settings are kept in the KV
+// store.
+// -----------------------------------------------------------------------------
+
+// KV store keys.
+const (
+	luckUserPrefix    string = "luck_user_"    // + user ID: "on" or "off".
+	luckChannelPrefix string = "luck_channel_" // + channel ID: "on" or "off".
+)
+
+// loadLuck - Get a luck setting: "on", "off", or "" if it isn't set.
+func (p *RollyPlugin) loadLuck(key string) (string, *model.AppError) {
+	data, err := p.API.KVGet(key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// saveLuck - Change a luck setting; "" goes back to the default.
+func (p *RollyPlugin) saveLuck(key string, setting string) *model.AppError {
+	if setting == "" {
+		return p.API.KVDelete(key)
+	}
+
+	return p.API.KVSet(key, []byte(setting))
+}
+
+// ShowLuck - Does this user see how lucky their rolls are in this channel?
+func (p *RollyPlugin) ShowLuck(userID string, channelID string) bool {
+	for _, key := range []string{luckUserPrefix + userID, luckChannelPrefix + channelID} {
+		setting, err := p.loadLuck(key)
+		if err != nil {
+			p.API.LogWarn("Can't load the luck setting "+key+".", "err", err.Error())
+			return false
+		}
+		if setting != "" {
+			return setting == "on"
+		}
+	}
+
+	return false
+}
+
+// Luck - Say how lucky a result was, like "🍀 Top 8% result, expected 10.5",
+// or nothing if that can't be worked out exactly.
+func (p *RollyPlugin) Luck(result RollResult) string {
+	if result.Text != "" {
+		return ""
+	}
+
+	stats, err := p.ExactStats(result.Roll)
+	if err != nil || stats.IsBool || len(stats.Totals) < 2 {
+		return ""
+	}
+
+	luck := ""
+	if atLeast := stats.Totals.AtLeast(result.Total); atLeast <= 0.5 {
+		// Past the end of an exploding die's distribution is still lucky.
+		luck = "🍀 Top " + FormatChance(math.Max(atLeast, math.SmallestNonzeroFloat64))
+	} else {
+		atMost := 1 - atLeast + stats.Totals[distributionKey(result.Total)]
+		luck = "🌧️ Bottom " + FormatChance(atMost)
+	}
+
+	return fmt.Sprintf("%v result, expected %v ([chart](%v))",
+		luck, FormatValue(stats.Totals.Mean()), MarkedChartURL(stats.Roll, result.Total))
+}
+
+// AddLuck - Add how lucky each result was, right after its total (and before
+// any table of targets).
+func (p *RollyPlugin) AddLuck(results []RollResult) []RollResult {
+	var lucky []RollResult
+	for _, result := range results {
+		if luck := p.Luck(result); luck != "" {
+			result.Extra = append([]string{luck}, result.Extra...)
+		}
+		lucky = append(lucky, result)
+	}
+
+	return lucky
+}
+
+// LuckCommand - Turn luck on or off for the user, or for the channel, like
+// "on" or "channel off"; "default" goes back to the channel's setting (or
+// off).
+func (p *RollyPlugin) LuckCommand(userID string, channelID string, args string) (*model.CommandResponse, *model.AppError) {
+	response := &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Username:     pluginName,
+		IconURL:      iconURI,
+	}
+
+	fields := strings.Fields(strings.ToLower(args))
+	key, setting := luckUserPrefix+userID, ""
+	if len(fields) > 0 && fields[0] == "channel" {
+		key = luckChannelPrefix + channelID
+		fields = fields[1:]
+	}
+	if len(fields) > 0 {
+		setting = fields[0]
+	}
+
+	switch {
+	case len(fields) == 0 && key == luckUserPrefix+userID:
+		mine, err := p.loadLuck(luckUserPrefix + userID)
+		if err != nil {
+			return nil, err
+		}
+		channel, err := p.loadLuck(luckChannelPrefix + channelID)
+		if err != nil {
+			return nil, err
+		}
+
+		response.Text = fmt.Sprintf("Luck is %v for you, and %v in this channel.", describeLuck(mine), describeLuck(channel))
+		return response, nil
+	case len(fields) != 1 || (setting != "on" && setting != "off" && setting != "default"):
+		response.Text = "Like `/roll luck on`, `/roll luck off` or `/roll luck default`; add `channel` (like `/roll luck channel on`) for everyone in the channel."
+		return response, nil
+	}
+
+	if setting == "default" {
+		setting = ""
+	}
+	if err := p.saveLuck(key, setting); err != nil {
+		return nil, err
+	}
+
+	if key == luckUserPrefix+userID {
+		response.Text = fmt.Sprintf("Luck is %v for you.", describeLuck(setting))
+	} else {
+		// Everyone's rolls change, so tell everyone.
+		response.ResponseType = model.COMMAND_RESPONSE_TYPE_IN_CHANNEL
+		response.Text = fmt.Sprintf("🍀 Luck is %v in this channel.", describeLuck(setting))
+	}
+
+	return response, nil
+}
+
+// describeLuck - Say what a luck setting means.
+func describeLuck(setting string) string {
+	if setting == "" {
+		return "not set"
+	}
+
+	return setting
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Luck.
+// -----------------------------------------------------------------------------
+
+// TestLuck - Make sure lucky and unlucky rolls are spotted.
+func TestLuck(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	for _, test := range []struct {
+		result RollResult
+		luck   string
+	}{
+		{RollResult{Roll: "2d6+3", Total: 12}, "🍀 Top 27.8% result, expected 10 ([chart](/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=2d6%2B3&mark=12))"},
+		{RollResult{Roll: "1d20", Total: 20}, "🍀 Top 5% result, expected 10.5 ([chart](/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=1d20&mark=20))"},
+		{RollResult{Roll: "1d20", Total: 1}, "🌧️ Bottom 5% result, expected 10.5 ([chart](/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=1d20&mark=1))"},
+		{RollResult{Roll: "4d6kh3", Total: 10}, "🌧️ Bottom 26.9% result, expected 12.24 ([chart](/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=4d6kh3&mark=10))"},
+		{RollResult{Roll: "1d6!", Total: 200}, "🍀 Top < 0.1% result, expected 4.2 ([chart](/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=1d6%21&mark=200))"},
+
+		// Nothing to say.
+		{RollResult{Roll: "1d20+7 >= 15", Total: 1}, ""},
+		{RollResult{Roll: "1d6 until 6", Total: 3}, ""},
+		{RollResult{Roll: "dnd", Text: "D&D standard:"}, ""},
+		{RollResult{Roll: "damage 1d8+3 slashing", Total: 7}, ""},
+		{RollResult{Roll: "2d{3,3}", Total: 6}, ""},
+		{RollResult{Roll: "1d1000000000", Total: 5}, ""},
+		{RollResult{Roll: "5..1000000+1", Total: 6}, ""},
+	} {
+		assert.EqualValues(t, p.Luck(test.result), test.luck, test.result.Roll)
+	}
+
+	extra := []string{"", "| Target | Result | Margin |"}
+	lucky := p.AddLuck([]RollResult{{Roll: "1d20", Total: 20, Extra: extra}, {Roll: "dnd", Text: "D&D standard:"}})
+	assert.Len(t, lucky, 2)
+	assert.EqualValues(t, lucky[0].Extra[0], "🍀 Top 5% result, expected 10.5 ([chart](/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=1d20&mark=20))")
+	assert.EqualValues(t, lucky[0].Extra[1:], extra)
+	assert.Len(t, extra, 2)
+	assert.Nil(t, lucky[1].Extra)
+}
+
+// TestLuckCommand - Make sure luck can be turned on and off for users and
+// channels.
+func TestLuckCommand(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+
+	run := func(userID string, cmd string) *model.CommandResponse {
+		resp, err := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{Command: cmd, UserId: userID, ChannelId: "channel"})
+		assert.Nil(t, err)
+		return resp
+	}
+	lucky := regexp.MustCompile(`\n(🍀 Top|🌧️ Bottom) [0-9.]+% result, expected 10.5 \(\[chart\]\(/plugins/ca.taffer.mm-rolly/stats/chart.png\?roll=1d20&mark=[0-9]+\)\)`)
+
+	assert.EqualValues(t, run("userid", "/roll luck").Text, "Luck is not set for you, and not set in this channel.")
+	assert.False(t, lucky.MatchString(run("userid", "/roll 1d20").Attachments[0].Text))
+
+	resp := run("userid", "/roll luck on")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, "Luck is on for you.")
+	assert.True(t, lucky.MatchString(run("userid", "/roll 1d20").Attachments[0].Text))
+	assert.True(t, p.ShowLuck("userid", "channel"))
+	assert.False(t, p.ShowLuck("other", "channel"))
+
+	// The user's setting beats the channel's.
+	resp = run("other", "/roll luck channel off")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, "🍀 Luck is off in this channel.")
+	assert.True(t, p.ShowLuck("userid", "channel"))
+	assert.EqualValues(t, run("userid", "/roll luck").Text, "Luck is on for you, and off in this channel.")
+
+	run("other", "/roll luck channel on")
+	assert.True(t, p.ShowLuck("other", "channel"))
+	assert.False(t, p.ShowLuck("other", "elsewhere"))
+
+	assert.EqualValues(t, run("userid", "/roll luck off").Text, "Luck is off for you.")
+	assert.False(t, p.ShowLuck("userid", "channel"))
+	assert.EqualValues(t, run("userid", "/roll luck Default").Text, "Luck is not set for you.")
+	assert.True(t, p.ShowLuck("userid", "channel"))
+
+	for _, cmd := range []string{"/roll luck maybe", "/roll luck channel", "/roll luck on off"} {
+		assert.EqualValues(t, run("userid", cmd).Text, "Like `/roll luck on`, `/roll luck off` or `/roll luck default`; add `channel` (like `/roll luck channel on`) for everyone in the channel.", cmd)
+	}
+}
+
+// TestFairLuck - Make sure luck isn't part of a provably fair roll.
+func TestFairLuck(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+	p.setConfiguration(&configuration{ProvablyFair: true})
+
+	runFairCommand(t, p, "/roll luck on")
+	resp := runFairCommand(t, p, "/roll 1d20")
+	assert.Contains(t, resp.Attachments[0].Text, " result, expected 10.5 ")
+
+	rollID := regexp.MustCompile("`([0-9a-f]{8}-1)`").FindStringSubmatch(resp.Attachments[0].Text)[1]
+	revealSeed(t, p)
+	resp = runFairCommand(t, p, "/roll verify "+rollID)
+	assert.Contains(t, resp.Text, "✅ Rolling it again gives the same result:")
+	assert.False(t, strings.Contains(resp.Text, "expected"))
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
 
 	"github.com/mattermost/mattermost-server/plugin"
@@ -11,14 +10,17 @@ import (
 func main() {
 	rolly := &RollyPlugin{}
 
-	// Seed the pseudo-random number generator with sort of random data.
+	// Pick a master seed for the random number generators.
 	// This only needs to be done once per instance.
 	rolly.SeedRng()
 
-	if len(os.Args) > 1 {
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		// Check a receipt, like: verify <public key> <receipt>
+		os.Exit(verifyCommand(os.Args[2:]))
+	} else if len(os.Args) > 1 {
 		// Ad-hoc testing... runs HandleRoll() on command-line args.
 		rolly.Init()
-		rand.Seed(0) // Make these deterministic.
+		rolly = rolly.WithRNG(NewRNG("math", 0)) // Make these deterministic.
 
 		for idx := 1; idx < len(os.Args); idx++ {
 			fmt.Println(idx, "=", rolly.HandleRoll(os.Args[idx], "Arg: "))
@@ -27,3 +29,40 @@ func main() {
 		plugin.ClientMain(rolly)
 	}
 }
+
+// verifyCommand - Check a pasted receipt against the public key.
+//
+// Returns the exit status.
+func verifyCommand(args []string) int {
+	if len(args) != 2 {
+		fmt.Println("Usage: verify <public key> <receipt>")
+		fmt.Println("The public key is at /plugins/ca.taffer.mm-rolly/receipts/key on your Mattermost server.")
+		return 2
+	}
+
+	key, err := ParsePublicKey(args[0])
+	if err != nil {
+		fmt.Println("❌", err)
+		return 1
+	}
+
+	receipt, err := VerifyReceipt(key, args[1])
+	if err != nil {
+		fmt.Println("❌", err)
+		return 1
+	}
+
+	fmt.Println("✅ The receipt is genuine.")
+	fmt.Println("Roll:   ", receipt.Roll)
+	if receipt.Text != "" {
+		fmt.Println("Result: ", receipt.Text)
+	} else {
+		fmt.Println("Dice:   ", receipt.Dice)
+		fmt.Println("Total:  ", receipt.Total)
+	}
+	fmt.Println("User:   ", receipt.User, "("+receipt.UserID+")")
+	fmt.Println("Channel:", receipt.Channel)
+	fmt.Println("Time:   ", receipt.Time)
+
+	return 0
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Normalizing rolls.
+//
+// Rolls are echoed the way they were actually rolled, with the defaults filled
+// in and the limits applied, so "d3" shows up as "1d3" and "1000d6" as "100d6".
+// This follows the same path as RollOne(), without rolling anything.
+// -----------------------------------------------------------------------------
+
+// Normalize - Write a roll the way it gets rolled, like "1d3" for "d3".
+//
+// Anything that can't be rolled is returned as-is.
+func (p *RollyPlugin) Normalize(rollArg string) string {
+	switch {
+	case p.comboPattern.MatchString(rollArg):
+		return strings.ToLower(rollArg)
+	case p.repeatPattern.MatchString(rollArg):
+		return p.normalizeRepeat(rollArg)
+	case p.vsPattern.MatchString(rollArg):
+		matches := FindNamedSubstrings(p.vsPattern, rollArg)
+
+		return p.Normalize(matches["roll"]) + " vs " + strings.Replace(matches["targets"], " ", "", -1)
+	case p.damagePattern.MatchString(rollArg):
+		return p.normalizeDamage(FindNamedSubstrings(p.damagePattern, rollArg)["damage"], rollArg)
+	case p.simplePattern.MatchString(rollArg):
+		return "1d" + normalizeSides(rollArg)
+	case p.rollPattern.MatchString(rollArg) && !p.isZeroBased(rollArg):
+		matches := FindNamedSubstrings(p.rollPattern, rollArg)
+
+		sides := normalizeSides(matches["num_sides"])
+		modifier, modifierValue := matches["modifier"], matches["modifier_value"]
+		if modifier != "" && modifier != "!" && modifierValue == "" {
+			modifierValue = "0"
+		}
+
+		return fmt.Sprintf("%dd%v%v%v", normalizeCount(matches["num_dice"]), sides, modifier, modifierValue)
+	case p.poolPattern.MatchString(rollArg):
+		return p.normalizePool(rollArg)
+	case p.d6Pattern.MatchString(rollArg):
+		matches := FindNamedSubstrings(p.d6Pattern, rollArg)
+
+		return fmt.Sprintf("d6sys %dD%v%v", normalizeCount(matches["num_dice"]), matches["modifier"], matches["modifier_value"])
+	case p.facesPattern.MatchString(rollArg):
+		matches := FindNamedSubstrings(p.facesPattern, rollArg)
+
+		faces := SplitFaces(matches["faces"])
+		if len(faces) == 0 {
+			return rollArg
+		}
+
+		return fmt.Sprintf("%dd{%v}", normalizeCount(matches["num_dice"]), strings.Join(faces, ","))
+	}
+
+	if expr, err := p.ParseExpression(rollArg); err == nil {
+		return expr.format()
+	}
+
+	return rollArg
+}
+
+// normalizeCount - Turn the num_dice match into the number of dice rolled.
+func normalizeCount(numDiceMatch string) int {
+	numDice, _ := clampDice(numDiceMatch, nil)
+
+	return numDice
+}
+
+// normalizeSides - Turn the num_sides match into the sides rolled, like "2"
+// for "0". One-sided dice are left alone, since they aren't rolled at all.
+func normalizeSides(sides string) string {
+	if oneSided(sides) {
+		return sides
+	}
+
+	sides, _ = clampSides(sides, nil)
+
+	return sides
+}
+
+// normalizeRepeat - Normalize a repeated roll, like "6x 4d6kh3 sort".
+func (p *RollyPlugin) normalizeRepeat(rollArg string) string {
+	matches := FindNamedSubstrings(p.repeatPattern, rollArg)
+
+	roll, countMatch := matches["roll"], matches["count"]
+	if roll == "" {
+		roll, countMatch = matches["brace_roll"], matches["brace_count"]
+	}
+
+	count, _ := clampRepeats(countMatch, nil)
+
+	return strings.TrimSpace(fmt.Sprintf("%dx %v %v", count, p.Normalize(roll), strings.ToLower(strings.TrimSpace(matches["aggregates"]))))
+}
+
+// normalizePool - Normalize a dice pool, like "8d10e9 rote".
+func (p *RollyPlugin) normalizePool(rollArg string) string {
+	matches := FindNamedSubstrings(p.poolPattern, rollArg)
+
+	_, mods, _ := p.parsePoolMods(matches)
+
+	return fmt.Sprintf("%dd10%v%v", normalizeCount(matches["num_dice"]), mods, strings.ToLower(matches["rote"]))
+}
+
+// normalizeDamage - Normalize a damage roll, like "damage 1d8+3 fire crit".
+func (p *RollyPlugin) normalizeDamage(damage string, rollArg string) string {
+	terms, crit, adjustments := SplitDamage(damage)
+
+	expr, err := p.ParseExpression(terms)
+	if err != nil {
+		return rollArg
+	}
+
+	normalized := "damage " + expr.format()
+	if crit {
+		normalized += " crit"
+	}
+	for _, adjustment := range []string{"resist", "vuln", "immune"} {
+		var types []string
+		for damageType, adjusted := range adjustments {
+			if adjusted == adjustment {
+				types = append(types, damageType)
+			}
+		}
+		sort.Strings(types)
+
+		if len(types) > 0 {
+			normalized += " " + adjustment + " " + strings.Join(types, ",")
+		}
+	}
+
+	return normalized
+}
+
+// NormalizeCommand - Show how each roll in a command gets rolled, without
+// rolling anything.
+func (p *RollyPlugin) NormalizeCommand(command string) (*model.CommandResponse, *model.AppError) {
+	text := "Nothing to normalize."
+
+	rolls := SplitRolls(command)
+	if len(rolls) > 0 {
+		var lines []string
+		for _, roll := range rolls {
+			lines = append(lines, fmt.Sprintf("* `%v` → `%v`", roll, p.Normalize(roll)))
+		}
+		text = strings.Join(lines, "\n")
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Text:         text,
+		Username:     pluginName,
+		IconURL:      iconURI,
+	}, nil
+}
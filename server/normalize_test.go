@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Normalizing rolls.
+// -----------------------------------------------------------------------------
+
+// TestNormalize - Make sure rolls are written the way they're rolled.
+func TestNormalize(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	normalized := map[string]string{
+		// Defaults and limits.
+		"6":      "1d6",
+		"%":      "1d%",
+		"d3":     "1d3",
+		"1000d6": "100d6",
+		"0d6":    "1d6",
+		"2d6+":   "2d6+0",
+		"d0":     "1d2",
+		"0":      "1d2",
+		"d1":     "1d1",
+		"2d01":   "2d2",
+		"4d6<1":  "4d6<1",
+
+		// Pools, D6 System and custom faces.
+		"8d10e5t11 rote":  "8d10e8t8 rote",
+		"10d10dd":         "10d10dd",
+		"d6sys 300D+2":    "d6sys 100D+2",
+		"0d{ hit, miss }": "1d{hit,miss}",
+
+		// Expressions.
+		"d20+5":                     "1d20+5",
+		"1d20+7 >= 15 ? 2d6+4 : 0":  "1d20+7 >= 15 ? 2d6+4 : 0",
+		"max( 1d20, 1d20 )+5":       "max(1d20, 1d20)+5",
+		"(1d4)d6":                   "(1d4)d6",
+		"d%/2":                      "1d%/2",
+		"-2-1d4":                    "-2-1d4",
+		"1d6 until total > 20":      "1d6 until total > 20",
+		"200d6kh3":                  "100d6kh3",
+		"1d8+3[slashing] + 1[fire]": "1d8+3[slashing]+1[fire]",
+
+		// Everything else.
+		"3x d20 SORT best 2": "3x 1d20 sort best 2",
+		"{2d6}*50":           "20x 2d6",
+		"D&D+":               "d&d+",
+		"1d20+6 vs 12, 15":   "1d20+6 vs 12,15",
+		"damage 1d8+3 slashing + 2d6 fire crit resist fire,cold": "damage 1d8+3[slashing]+2d6[fire] crit resist cold,fire",
+		"monkey":  "monkey",
+		"d{1,,2}": "d{1,,2}",
+	}
+	for rollArg, expected := range normalized {
+		assert.EqualValues(t, p.Normalize(rollArg), expected, rollArg)
+	}
+
+	// Normalizing again doesn't change anything.
+	for _, expected := range normalized {
+		assert.EqualValues(t, p.Normalize(expected), expected, expected)
+	}
+}
+
+// TestNormalizeCommand - Make sure each roll is shown normalized.
+func TestNormalizeCommand(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	resp, err := p.NormalizeCommand("d3 1d20 + 5")
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.Text, "* `d3` → `1d3`\n* `1d20 + 5` → `1d20+5`")
+
+	resp, err = p.NormalizeCommand("")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(resp.Text, "Nothing"))
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"math/rand"
+	"crypto/ed25519"
 	"regexp"
-	"time"
+	"strings"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/mattermost/mattermost-server/model"
@@ -20,10 +21,44 @@ type RollyPlugin struct {
 	// Is this active?
 	active bool
 
+	// Settings from plugin.json; see configuration.go.
+	configurationLock sync.RWMutex
+	configuration     *configuration
+
 	// Dice rolling patterns.
-	simplePattern *regexp.Regexp
-	comboPattern  *regexp.Regexp
-	rollPattern   *regexp.Regexp
+	dicePatterns
+
+	// Where the dice come from; see rng.go.
+	seed     uint64 // Master seed for the streams.
+	requests uint64 // Streams made so far; use atomically.
+	rng      RNG    // This stream, if it is one.
+
+	// Provably fair rolls; see fair.go.
+	fairLock sync.Mutex
+
+	// Signs roll receipts; see receipts.go.
+	receiptKey ed25519.PrivateKey
+
+	// Distributions worked out so far; see stats.go.
+	statsLock  sync.Mutex
+	statsCache map[string]*RollStats
+
+	// Keeps the roll history's indexes straight; see history.go.
+	historyLock sync.Mutex
+}
+
+// dicePatterns - Patterns for the different sorts of rolls; see Init().
+type dicePatterns struct {
+	simplePattern  *regexp.Regexp
+	comboPattern   *regexp.Regexp
+	rollPattern    *regexp.Regexp
+	poolPattern    *regexp.Regexp
+	poolModPattern *regexp.Regexp
+	d6Pattern      *regexp.Regexp
+	facesPattern   *regexp.Regexp
+	repeatPattern  *regexp.Regexp
+	damagePattern  *regexp.Regexp
+	vsPattern      *regexp.Regexp
 }
 
 // -----------------------------------------------------------------------------
@@ -40,11 +75,42 @@ const (
 	trigger    string = "roll"
 	pluginName string = "Rolly"
 
-	simpleRegex string = `^(?P<num_sides>[0-9\%F]+)$`
-	comboRegex  string = `(?i)^((?P<combo_name>(d[n&]d\+?|open)))$`
-	rollRegex   string = `(?i)^((?P<num_dice>[0-9]+)?d)?(?P<num_sides>[0-9\%F]+)((?P<modifier>[+-/<>x*!])(?P<modifier_value>[0-9]*))?$`
+	simpleRegex  string = `^(?P<num_sides>[0-9\%F]+)$`
+	comboRegex   string = `(?i)^((?P<combo_name>(d[n&]d\+?|open)))$`
+	rollRegex    string = `(?i)^((?P<num_dice>[0-9]+)?d)?(?P<num_sides>[0-9\%F]+)((?P<modifier>[+-/<>x*!])(?P<modifier_value>[0-9]*))?$`
+	poolRegex    string = `(?i)^(?P<num_dice>[0-9]+)?d10(?P<pool_mods>(e[0-9]*|t[0-9]+|dd|r)*)(?P<rote> rote)?$`
+	poolModRegex string = `(?i)(?P<mod_name>e|t|dd|r)(?P<mod_value>[0-9]*)`
+	d6Regex      string = `(?i)^d6sys ?(?P<num_dice>[0-9]+)D((?P<modifier>[+-])(?P<modifier_value>[0-9]+))?$`
+	facesRegex   string = `(?i)^(?P<num_dice>[0-9]+)?d\{(?P<faces>[^{}.]+)\}$`
+	vsRegex      string = `(?i)^(?P<roll>.+) vs (?P<targets>-?[0-9]+( ?, ?-?[0-9]+)*)$`
+	damageRegex  string = `(?i)^damage (?P<damage>.+)$`
+	repeatRegex  string = `(?i)^((?P<count>[0-9]+)x (?P<roll>.+?)|\{(?P<brace_roll>.+)\}\*(?P<brace_count>[0-9]+))(?P<aggregates>( (sort|sum|best [0-9]+|worst [0-9]+))*)$`
+
+	maxDice    int = 100     // Most dice we'll roll (or reroll) for one request.
+	maxSides   int = 1000000 // Most sides a die can have, or numbers a range can span.
+	maxRepeats int = 20      // Most times we'll repeat a roll for one request.
+	maxTargets int = 20      // Most targets we'll compare one roll against.
 )
 
+// Words that modify the roll before them, so "8d10 rote" is one request.
+var suffixWords = []string{"rote"}
+
+// Words that join the rolls on either side, so "1d6 until total > 20" and
+// "1d20+6 vs 12,15" are one request.
+var joinWords = []string{"until", "total", "vs"}
+
+// Words that modify the roll after them, so "d6sys 5D+2" and
+// "damage 1d8+3 slashing" are one request.
+var prefixWords = []string{"d6sys", "damage"}
+
+// Words that sum up a repeated roll, so "6x 4d6kh3 sort best 3" is one request.
+var aggregateWords = []string{"sort", "sum", "best", "worst"}
+
+// An expression with spaces in it continues after (or before) an operator, so
+// "1d20+7 >= 15 ? 2d6+4 : 0" is one request.
+const continuedBy string = "+-*/^~<>=!?:,.("
+const continues string = "+-*/^~<>=?:,.)["
+
 // -----------------------------------------------------------------------------
 // Different commands the roller knows.
 // -----------------------------------------------------------------------------
@@ -53,26 +119,45 @@ const (
 func (p *RollyPlugin) GetHelp() (*model.CommandResponse, *model.AppError) {
 	helpText := `Support "any" [reasonable](https://en.wikipedia.org/wiki/Dice_notation) dice rolling request:
 
-* *x*d*y* or *x*D*y* to roll a *y* sided die *x* times
-* modifiers: *x*d*y*+*z* (supported modifiers: +, -, x or *, /)
-* exploding dice (for every max value, roll and add): *x*d*y*!
-* *x*d% - same as *x*d100
-* *x*dF - roll
-  [FUDGE](https://en.wikipedia.org/wiki/Fudge_%28role-playing_game_system%29)
-  dice
-* *x*d*y*<*z* - discards the lowest *z* rolls (so 4d6<1 would return a value
-  between 3 and 18)
-* *x*d*y*>*z* - keeps the best *z* rolls (so 4d6>1 would return a value
-  between 1 and 6)
+* *x*d*y* - roll a *y* sided die *x* times; add +, -, x or *, / *z* to change the total
+* *x*d*y*! explodes; *x*d% is *x*d100; *x*dF rolls [FUDGE](https://en.wikipedia.org/wiki/Fudge_%28role-playing_game_system%29) dice
+* *x*d*y*<*z* drops the lowest *z* dice, and *x*d*y*>*z* keeps the best *z*
+* *x*d*y*kh*z*, kl*z*, dh*z* or dl*z* - keep or drop the highest or lowest *z* dice, like 4d6kh3
+* *x*d10e*z*, t*z*, r or rote - Storyteller dice pools, like 8d10e9 rote
+* *x*d10dd - Exalted dice pool: 7 or more succeeds, 10s count twice
+* d6sys *x*D+*z* - West End Games D6 System, with a wild die
+* *x*d{*a*,*b*,...} or *x*d{*name*} - custom faces, like d{hit,miss,miss}, or a custom die
+* *a*..*b*, *x*d{*a*..*b*} or *x*d0-*y* - numbered ranges, like 5..15 or d0-9
+* rolls and numbers with +, -, x or *, / (//, /^ or /~ to round) and parentheses, like (d{-3..3}+1)*2
+* (*expression*)d*y* or *x*d(*expression*) - roll how many dice or sides, like (1d4)d6
+* floor(), ceil(), round(), abs(), min() and max(), like max(1d20, 1d20)+5
+* *test* ? *a* : *b*, with nat for the first die, like 1d20+7 >= 15 ? (nat == 20 ? 4d6+4 : 2d6+4) : 0
+* *n*x *roll* or {*roll*}\**n* - roll it *n* times, adding sort, sum, best *z* or worst *z*
+* *roll* until *test* - roll until it passes, like 1d6 until 6 or 1d6 until total > 20
+* *roll*[*label*] - total the terms since the last label, like 1d8+3[slashing] + 2d6[fire]
+* *rolls* # *comment* - say what the rolls are for
+* damage *roll* - typed damage, like damage 1d8+3 slashing + 2d6 fire crit resist fire
+* *roll* vs *a*,*b*,... - check one roll against several targets, like 1d20+6 vs 12,15,18
+* /r, !roll, [[1d20+5]], 4d6k3 and 4d6d1 from other dice bots work too
+* dnd (6x 3d6), dnd+ (6x 4d6<1) and open (d%, rolling again on 95 or more) - nerd combos
 
 If *x* isn't specified, it defaults to 1. If *y* is less than 2, it defaults
-to 2. If you specify a modifier, you must also specify a *z* value.
+to 2.
+
+Commands:
 
-Supports these nerd combos:
+* normalize *rolls* - show how rolls will be read, without rolling them
+* stats *roll* [vs *a*,*b*,...] - work out a roll's odds without rolling it
+* compare *roll* *roll* [vs *a*,*b*,...] - the chance one roll beats another
+* luck [channel] on, off or default - say how lucky each roll was
+* history [@*user*] [*n*] - list the latest rolls in this channel
+* seed - show the hash of the provably fair seed
+* reveal-seed - publish the seed and start a new one (System Admins only)
+* verify *roll-id* - work out a provably fair roll again
+* selftest d*y* *n* - check the dice look random (System Admins only)
+* help - show this
 
-* dnd - same as 3d6 six times (standard D&D or Pathfinder)
-* dnd+ - same as 4d6<1 six times (common house rule for D&D or Pathfinder)
-* open - roll d%, if it's >= 95, roll again and add, repeating if necessary`
+See the [README](` + repoURI + `) for the details and more examples.`
 
 	props := map[string]interface{}{
 		"from_webhook":  "true",
@@ -100,6 +185,13 @@ func (p *RollyPlugin) Init() {
 	p.simplePattern = regexp.MustCompile(simpleRegex)
 	p.comboPattern = regexp.MustCompile(comboRegex)
 	p.rollPattern = regexp.MustCompile(rollRegex)
+	p.poolPattern = regexp.MustCompile(poolRegex)
+	p.poolModPattern = regexp.MustCompile(poolModRegex)
+	p.d6Pattern = regexp.MustCompile(d6Regex)
+	p.facesPattern = regexp.MustCompile(facesRegex)
+	p.repeatPattern = regexp.MustCompile(repeatRegex)
+	p.damagePattern = regexp.MustCompile(damageRegex)
+	p.vsPattern = regexp.MustCompile(vsRegex)
 }
 
 // GetCommand - Return the Command to register.
@@ -152,6 +244,115 @@ func min(x, y int) int {
 	return y
 }
 
+// SplitComment - Split a command from its comment, like "1d20+5 # attack".
+//
+// Returns the command and the comment, either of which might be empty.
+func SplitComment(command string) (string, string) {
+	parts := strings.SplitN(command, "#", 2)
+	if len(parts) < 2 {
+		return strings.TrimSpace(command), ""
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// SplitRolls - Split a command into separate roll requests.
+//
+// Rolls are separated by whitespace, but suffixWords stick to the roll in
+// front of them, prefixWords stick to the roll after them, and expressions
+// stick together around their operators.
+func SplitRolls(command string) []string {
+	rolls := []string{}
+
+	for _, field := range strings.Fields(command) {
+		last := len(rolls) - 1
+		if last >= 0 && (isOneOf(field, suffixWords) || isOneOf(field, joinWords)) {
+			rolls[last] += " " + strings.ToLower(field)
+		} else if last >= 0 && isPrefix(rolls[last]) {
+			rolls[last] = strings.ToLower(rolls[last]) + " " + field
+		} else if last >= 0 && isRepeat(rolls[last]) && isAggregate(rolls[last], field) {
+			rolls[last] += " " + strings.ToLower(field)
+		} else if last >= 0 && isDamage(rolls[last]) && isDamageType(strings.ToLower(strings.Replace(field, ",", "", -1))) {
+			rolls[last] += " " + strings.ToLower(field)
+		} else if last >= 0 && (isContinued(rolls[last]) || strings.ContainsAny(field[:1], continues)) {
+			rolls[last] += " " + field
+		} else {
+			rolls = append(rolls, field)
+		}
+	}
+
+	return rolls
+}
+
+// Does this roll end in an operator, like "1d20+7 >=" or "1d6 until", or in
+// the middle of a label, like "2d6[cold"?
+//
+// Exploding dice end in "!", but "2d6!" is a whole roll.
+func isContinued(roll string) bool {
+	fields := strings.Fields(roll)
+	if isOneOf(fields[len(fields)-1], joinWords) || strings.Count(roll, "[") > strings.Count(roll, "]") {
+		return true
+	}
+
+	return strings.ContainsAny(roll[len(roll)-1:], continuedBy) && !strings.HasSuffix(roll, "!")
+}
+
+// Is this roll nothing but prefixes, like "d6sys" or "6x d6sys"?
+func isPrefix(roll string) bool {
+	for _, field := range strings.Fields(roll) {
+		if !isOneOf(field, prefixWords) && !isRepeatCount(field) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Is this a damage roll, like "damage 1d8+3" or "6x damage 1d8+3"?
+func isDamage(roll string) bool {
+	for _, field := range strings.Fields(roll) {
+		if !isRepeatCount(field) {
+			return strings.EqualFold(field, "damage")
+		}
+	}
+
+	return false
+}
+
+// Is this how many times to repeat the next roll, like "6x"?
+func isRepeatCount(roll string) bool {
+	count := strings.TrimLeft(roll, "0123456789")
+
+	return len(count) < len(roll) && strings.EqualFold(count, "x")
+}
+
+// Is this a repeated roll, like "6x 4d6kh3" or "{4d6kh3}*6"?
+func isRepeat(roll string) bool {
+	fields := strings.Fields(roll)
+
+	return strings.HasPrefix(roll, "{") || (len(fields) > 1 && isRepeatCount(fields[0]))
+}
+
+// Does this field sum up the repeated roll, like "sort", "best" or the "3"
+// after "best"?
+func isAggregate(roll string, field string) bool {
+	fields := strings.Fields(roll)
+	last := fields[len(fields)-1]
+
+	return isOneOf(field, aggregateWords) || (isOneOf(last, []string{"best", "worst"}) && isNumber(field))
+}
+
+// Is word one of these words (ignoring case)?
+func isOneOf(word string, words []string) bool {
+	for _, candidate := range words {
+		if strings.EqualFold(word, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // FindNamedSubstrings - Return a map of named matches.
 func FindNamedSubstrings(re *regexp.Regexp, candidate string) map[string]string {
 	found := make(map[string]string)
@@ -166,22 +367,3 @@ func FindNamedSubstrings(re *regexp.Regexp, candidate string) map[string]string
 
 	return found
 }
-
-// -----------------------------------------------------------------------------
-// Random number generator.
-//
-// Created as methods rather than just calling rand.Seed(), etc. directly
-// because I'd like to make a fork of this that uses the ISARA Radiate toolkit
-// RNGs to generate cryptographically secure random numbers. Massive overkill
-// for this sort of application!
-// -----------------------------------------------------------------------------
-
-// SeedRng - Seed the random number generator.
-func (p *RollyPlugin) SeedRng() {
-	rand.Seed(time.Now().UnixNano())
-}
-
-// GetRandom - Gets a random number from [1, n].
-func (p *RollyPlugin) GetRandom(n int) int {
-	return rand.Intn(n) + 1
-}
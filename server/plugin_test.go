@@ -1,7 +1,6 @@
 package main
 
 import (
-	"math/rand"
 	"regexp"
 	"strings"
 	"testing"
@@ -31,6 +30,7 @@ func runTestPluginCommand(t *testing.T, cmd string) (*model.CommandResponse, *mo
 
 func initTestPlugin(t *testing.T) *RollyPlugin {
 	api := &plugintest.API{}
+	api.On("LoadPluginConfiguration", mock.Anything).Return(nil)
 	api.On("RegisterCommand", mock.Anything).Return(nil)
 	api.On("UnregisterCommand", mock.Anything, mock.Anything).Return(nil)
 	api.On("GetUser", mock.Anything).Return(&model.User{
@@ -40,6 +40,26 @@ func initTestPlugin(t *testing.T) *RollyPlugin {
 		FirstName: "User",
 		LastName:  "McUserface",
 	}, (*model.AppError)(nil))
+	api.On("GetUserByUsername", "hunter2").Return(&model.User{Id: "userid", Username: "hunter2"}, (*model.AppError)(nil))
+	api.On("GetUserByUsername", mock.Anything).Return((*model.User)(nil), model.NewAppError("GetUserByUsername", "No such user.", nil, "", 404))
+
+	api.On("HasPermissionTo", "adminid", mock.Anything).Return(true)
+	api.On("HasPermissionTo", mock.Anything, mock.Anything).Return(false)
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	// A KV store that lasts as long as the plugin.
+	store := make(map[string][]byte)
+	api.On("KVGet", mock.Anything).Return(func(key string) []byte {
+		return store[key]
+	}, (*model.AppError)(nil))
+	api.On("KVSet", mock.Anything, mock.Anything).Return(func(key string, value []byte) *model.AppError {
+		store[key] = value
+		return nil
+	})
+	api.On("KVDelete", mock.Anything).Return(func(key string) *model.AppError {
+		delete(store, key)
+		return nil
+	})
 
 	p := RollyPlugin{}
 	p.SetAPI(api)
@@ -71,12 +91,26 @@ func TestInit(t *testing.T) {
 	assert.Nil(t, p.simplePattern)
 	assert.Nil(t, p.comboPattern)
 	assert.Nil(t, p.rollPattern)
+	assert.Nil(t, p.poolPattern)
+	assert.Nil(t, p.poolModPattern)
+	assert.Nil(t, p.d6Pattern)
+	assert.Nil(t, p.facesPattern)
+	assert.Nil(t, p.repeatPattern)
+	assert.Nil(t, p.damagePattern)
+	assert.Nil(t, p.vsPattern)
 
 	p.Init()
 
 	assert.NotNil(t, p.simplePattern)
 	assert.NotNil(t, p.comboPattern)
 	assert.NotNil(t, p.rollPattern)
+	assert.NotNil(t, p.poolPattern)
+	assert.NotNil(t, p.poolModPattern)
+	assert.NotNil(t, p.d6Pattern)
+	assert.NotNil(t, p.facesPattern)
+	assert.NotNil(t, p.repeatPattern)
+	assert.NotNil(t, p.damagePattern)
+	assert.NotNil(t, p.vsPattern)
 }
 
 // TestGetCommand - How's this going to fail, really?
@@ -89,27 +123,6 @@ func TestGetCommand(t *testing.T) {
 	assert.EqualValues(t, cmd.Description, "Roll one or more dice. With combos!")
 }
 
-// TestSeedRng - Seed the default RNG.
-func TestSeedRng(t *testing.T) {
-	p := initTestPlugin(t)
-	p.SeedRng()
-
-	assert.NotNil(t, p) // Not actually testing anything useful.
-}
-
-// TestGetRandom - Make sure GetRandom() is returning values.
-func TestGetRandom(t *testing.T) {
-	p := initTestPlugin(t)
-	rand.Seed(0) // Make these deterministic.
-
-	val := p.GetRandom(1)
-	assert.EqualValues(t, val, 1)
-
-	val = p.GetRandom(6)
-	assert.True(t, val >= 1 && val <= 6)
-	assert.EqualValues(t, val, 1)
-}
-
 // TestGetName - Make sure GetName() does something suitable.
 func TestGetName(t *testing.T) {
 	p := initTestPlugin(t)
@@ -159,4 +172,47 @@ func TestFindNamedSubstrings(t *testing.T) {
 	assert.EqualValues(t, matches["num_sides"], "2")
 	assert.EqualValues(t, matches["modifier"], "+")
 	assert.EqualValues(t, matches["modifier_value"], "3")
+
+	// Test with the poolRegex.
+	pattern = regexp.MustCompile(poolRegex)
+	matches = FindNamedSubstrings(pattern, "8d10e9dd rote")
+	assert.EqualValues(t, matches["num_dice"], "8")
+	assert.EqualValues(t, matches["pool_mods"], "e9dd")
+	assert.EqualValues(t, matches["rote"], " rote")
+}
+
+// TestSplitRolls - Make sure prefix and suffix words, and expressions with
+// spaces, stay together.
+func TestSplitRolls(t *testing.T) {
+	assert.EqualValues(t, SplitRolls(""), []string{})
+	assert.EqualValues(t, SplitRolls(" 6  d10 2d4+2"), []string{"6", "d10", "2d4+2"})
+	assert.EqualValues(t, SplitRolls("8d10 Rote 3d6"), []string{"8d10 rote", "3d6"})
+	assert.EqualValues(t, SplitRolls("rote"), []string{"rote"})
+	assert.EqualValues(t, SplitRolls("D6sys 5D+2 d6sys"), []string{"d6sys 5D+2", "d6sys"})
+	assert.EqualValues(t, SplitRolls("1d20+7 >= 15 ? 2d6+4 : 0 3d6"), []string{"1d20+7 >= 15 ? 2d6+4 : 0", "3d6"})
+	assert.EqualValues(t, SplitRolls("max( 1d20, 1d20 ) 1d4"), []string{"max( 1d20, 1d20 )", "1d4"})
+	assert.EqualValues(t, SplitRolls("2d6! 1d8"), []string{"2d6!", "1d8"})
+	assert.EqualValues(t, SplitRolls("6X 4d6kh3 sort Best 3 2d6"), []string{"6x 4d6kh3 sort best 3", "2d6"})
+	assert.EqualValues(t, SplitRolls("{1d20 + 5}*3 sum 1d6 sum"), []string{"{1d20 + 5}*3 sum", "1d6", "sum"})
+	assert.EqualValues(t, SplitRolls("3x d6sys 3D+1"), []string{"3x d6sys 3D+1"})
+	assert.EqualValues(t, SplitRolls("6x"), []string{"6x"})
+	assert.EqualValues(t, SplitRolls("1d6 until 6 1d6 Until Total > 20 2d6"), []string{"1d6 until 6", "1d6 until total > 20", "2d6"})
+	assert.EqualValues(t, SplitRolls("1d8+3[slashing] + 2d6 [fire] 1d8[cold iron] 2d6"), []string{"1d8+3[slashing] + 2d6 [fire]", "1d8[cold iron]", "2d6"})
+	assert.EqualValues(t, SplitRolls("1d20+6 vs 12, 15,18 2d6 1d20 VS 3"), []string{"1d20+6 vs 12, 15,18", "2d6", "1d20 vs 3"})
+	assert.EqualValues(t, SplitRolls("Damage 1d8+3 Slashing + 2d6 fire crit resist fire,cold 1d20"), []string{"damage 1d8+3 slashing + 2d6 fire crit resist fire,cold", "1d20"})
+}
+
+// TestSplitComment - Make sure comments come off the end.
+func TestSplitComment(t *testing.T) {
+	command, comment := SplitComment(" 1d20+5 # attack the #1 goblin ")
+	assert.EqualValues(t, command, "1d20+5")
+	assert.EqualValues(t, comment, "attack the #1 goblin")
+
+	command, comment = SplitComment("2d6 ")
+	assert.EqualValues(t, command, "2d6")
+	assert.EqualValues(t, comment, "")
+
+	command, comment = SplitComment("#")
+	assert.EqualValues(t, command, "")
+	assert.EqualValues(t, comment, "")
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Signed roll receipts.
+//
+// Every roll can come with a receipt: the roll, its dice and total, who rolled
+// it, where and when, signed with the plugin's Ed25519 key. Rolls copied into
+// a forum post or a play-by-post document can be checked with the public key
+// (served from /receipts/key), even if the server is long gone:
+//
+//     plugin-linux-amd64 verify <public key> <receipt>
+// -----------------------------------------------------------------------------
+
+// Where the signing key is kept in the KV store.
+const receiptKeyKey string = "receipt_key"
+
+// Receipt - What a receipt says about a roll.
+type Receipt struct {
+	Roll    string `json:"roll"`           // Like "2d6+3".
+	Dice    string `json:"dice,omitempty"` // Like "[3 4]".
+	Total   string `json:"total,omitempty"`
+	Text    string `json:"text,omitempty"` // For combos and repeated rolls.
+	User    string `json:"user"`
+	UserID  string `json:"user_id"`
+	Channel string `json:"channel"`
+	Time    string `json:"time"` // RFC 3339, in UTC.
+}
+
+// NewReceipt - Make a receipt for a roll.
+func NewReceipt(result RollResult, userName string, userID string, channelID string, when time.Time) Receipt {
+	receipt := Receipt{
+		Roll:    result.Roll,
+		User:    userName,
+		UserID:  userID,
+		Channel: channelID,
+		Time:    when.UTC().Format(time.RFC3339),
+	}
+
+	if result.Text != "" {
+		receipt.Text = result.Text
+	} else {
+		receipt.Dice = result.Dice
+		receipt.Total = result.Answer
+	}
+
+	return receipt
+}
+
+// SignReceipt - Sign a receipt, giving something like "eyJyb2xs...Q.x7Gm...Aw".
+//
+// That's the receipt's JSON and its signature, both in URL-safe base64.
+func SignReceipt(key ed25519.PrivateKey, receipt Receipt) string {
+	data, _ := json.Marshal(receipt)
+	signature := ed25519.Sign(key, data)
+
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// VerifyReceipt - Check a receipt's signature, and get what it says.
+func VerifyReceipt(key ed25519.PublicKey, signed string) (*Receipt, error) {
+	parts := strings.Split(strings.Trim(strings.TrimSpace(signed), "`"), ".")
+	if len(parts) != 2 {
+		return nil, errors.New("that isn't a receipt")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("that isn't a receipt")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("that isn't a receipt")
+	}
+
+	if !ed25519.Verify(key, data, signature) {
+		return nil, errors.New("the signature doesn't match; the receipt was changed, or signed by someone else")
+	}
+
+	receipt := &Receipt{}
+	if err := json.Unmarshal(data, receipt); err != nil {
+		return nil, errors.New("that isn't a receipt")
+	}
+
+	return receipt, nil
+}
+
+// ParsePublicKey - Read a public key, as served from /receipts/key.
+func ParsePublicKey(text string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, errors.New("that isn't a public key")
+	}
+
+	return ed25519.PublicKey(data), nil
+}
+
+// FormatPublicKey - Write a public key the way ParsePublicKey() reads it.
+func FormatPublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// loadReceiptKey - Get the signing key, making one if there isn't one yet.
+func (p *RollyPlugin) loadReceiptKey() (ed25519.PrivateKey, *model.AppError) {
+	data, err := p.API.KVGet(receiptKeyKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == ed25519.PrivateKeySize {
+		return ed25519.PrivateKey(data), nil
+	}
+
+	_, key, keyErr := ed25519.GenerateKey(rand.Reader)
+	if keyErr != nil {
+		return nil, model.NewAppError("loadReceiptKey", "Can't make a signing key.", nil, keyErr.Error(), 0)
+	}
+	if err := p.API.KVSet(receiptKeyKey, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ServeReceiptKey - Serve the public key for checking receipts.
+func (p *RollyPlugin) ServeReceiptKey(w http.ResponseWriter, r *http.Request) {
+	if p.receiptKey == nil {
+		http.Error(w, "Receipts aren't signed yet.", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(FormatPublicKey(p.receiptKey.Public().(ed25519.PublicKey)) + "\n"))
+}
+
+// SignResults - Sign receipts for a request's rolls, one per line.
+func (p *RollyPlugin) SignResults(results []RollResult, userName string, userID string, channelID string) string {
+	now := time.Now()
+
+	var lines []string
+	for _, result := range results {
+		lines = append(lines, "`"+SignReceipt(p.receiptKey, NewReceipt(result, userName, userID, channelID, now))+"`")
+	}
+
+	return strings.Join(lines, "\n")
+}
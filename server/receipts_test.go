@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Signed roll receipts.
+// -----------------------------------------------------------------------------
+
+// TestNewReceipt - Make sure receipts say what was rolled.
+func TestNewReceipt(t *testing.T) {
+	when := time.Date(2018, 11, 3, 20, 15, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	receipt := NewReceipt(RollResult{Roll: "2d6+3", Dice: "[3 4]", Answer: "10"}, "User", "userid", "channel", when)
+	assert.EqualValues(t, receipt, Receipt{
+		Roll:    "2d6+3",
+		Dice:    "[3 4]",
+		Total:   "10",
+		User:    "User",
+		UserID:  "userid",
+		Channel: "channel",
+		Time:    "2018-11-04T01:15:00Z",
+	})
+
+	receipt = NewReceipt(RollResult{Roll: "dnd", Dice: "ignored", Text: "D&D standard:\n..."}, "User", "userid", "channel", when)
+	assert.EqualValues(t, receipt.Text, "D&D standard:\n...")
+	assert.Empty(t, receipt.Dice)
+}
+
+// TestSignReceipt - Make sure receipts can be checked, and changes get caught.
+func TestSignReceipt(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	otherPublic, _, _ := ed25519.GenerateKey(nil)
+
+	receipt := Receipt{Roll: "1d20", Dice: "[17]", Total: "17", User: "User", UserID: "userid", Channel: "channel", Time: "2018-11-04T01:15:00Z"}
+	signed := SignReceipt(private, receipt)
+	assert.EqualValues(t, len(strings.Split(signed, ".")), 2)
+
+	checked, err := VerifyReceipt(public, signed)
+	assert.Nil(t, err)
+	assert.EqualValues(t, *checked, receipt)
+
+	// Pasted with the backticks it's shown in.
+	checked, err = VerifyReceipt(public, " `"+signed+"` ")
+	assert.Nil(t, err)
+	assert.EqualValues(t, *checked, receipt)
+
+	// Signed by someone else.
+	_, err = VerifyReceipt(otherPublic, signed)
+	assert.EqualValues(t, err.Error(), "the signature doesn't match; the receipt was changed, or signed by someone else")
+
+	// Edited.
+	receipt.Total = "20"
+	edited := strings.Split(SignReceipt(private, receipt), ".")[0] + "." + strings.Split(signed, ".")[1]
+	_, err = VerifyReceipt(public, edited)
+	assert.EqualValues(t, err.Error(), "the signature doesn't match; the receipt was changed, or signed by someone else")
+
+	for _, broken := range []string{"", "nope", "a.b.c", "!!!.abc", "abc.!!!"} {
+		_, err = VerifyReceipt(public, broken)
+		assert.EqualValues(t, err.Error(), "that isn't a receipt", broken)
+	}
+}
+
+// TestParsePublicKey - Make sure public keys can be pasted.
+func TestParsePublicKey(t *testing.T) {
+	public, _, _ := ed25519.GenerateKey(nil)
+
+	key, err := ParsePublicKey(FormatPublicKey(public) + "\n")
+	assert.Nil(t, err)
+	assert.EqualValues(t, key, public)
+
+	_, err = ParsePublicKey("not base64!")
+	assert.EqualValues(t, err.Error(), "that isn't a public key")
+	_, err = ParsePublicKey("c2hvcnQ=")
+	assert.EqualValues(t, err.Error(), "that isn't a public key")
+}
+
+// TestSignedRolls - Make sure rolls come with receipts that check out.
+func TestSignedRolls(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+	p.setConfiguration(&configuration{SignRolls: true})
+
+	// The key is kept.
+	key := p.receiptKey
+	assert.NotNil(t, key)
+	assert.Nil(t, p.OnActivate())
+	assert.EqualValues(t, p.receiptKey, key)
+
+	// Get the public key.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/receipts/key", nil)
+	r.Header.Set("Mattermost-User-Id", "userid")
+	p.ServeHTTP(&plugin.Context{}, w, r)
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	public, err := ParsePublicKey(string(body))
+	assert.Nil(t, err)
+
+	resp, appErr := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{
+		Command:   "/roll 1d20+5 dnd",
+		ChannelId: "channel",
+		UserId:    "userid",
+	})
+	assert.Nil(t, appErr)
+	assert.EqualValues(t, resp.Attachments[0].Fields[0].Title, "🧾 Receipts")
+
+	receipts := strings.Split(resp.Attachments[0].Fields[0].Value.(string), "\n")
+	assert.Len(t, receipts, 2)
+
+	receipt, err := VerifyReceipt(public, receipts[0])
+	assert.Nil(t, err)
+	assert.EqualValues(t, receipt.Roll, "1d20+5")
+	assert.Contains(t, resp.Attachments[0].Text, "\"1d20+5\" = **"+receipt.Total+"**")
+	assert.EqualValues(t, receipt.User, "User")
+	assert.EqualValues(t, receipt.UserID, "userid")
+	assert.EqualValues(t, receipt.Channel, "channel")
+
+	receipt, err = VerifyReceipt(public, receipts[1])
+	assert.Nil(t, err)
+	assert.EqualValues(t, receipt.Roll, "dnd")
+	assert.True(t, strings.HasPrefix(receipt.Text, "D&D standard:"))
+
+	// Turned off.
+	p.setConfiguration(&configuration{})
+	resp, _ = p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{Command: "/roll 1d20"})
+	assert.Nil(t, resp.Attachments[0].Fields)
+}
+
+// TestServeReceiptKey - No key, nothing to serve.
+func TestServeReceiptKey(t *testing.T) {
+	p := initTestPlugin(t)
+	w := httptest.NewRecorder()
+	p.ServeReceiptKey(w, httptest.NewRequest("GET", "/receipts/key", nil))
+
+	assert.EqualValues(t, w.Result().StatusCode, 404)
+}
+
+// TestVerifyCommand - Make sure the command-line verifier works.
+func TestVerifyCommand(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	signed := SignReceipt(private, Receipt{Roll: "1d20", Dice: "[17]", Total: "17"})
+
+	assert.EqualValues(t, verifyCommand([]string{FormatPublicKey(public), signed}), 0)
+	assert.EqualValues(t, verifyCommand([]string{FormatPublicKey(public), signed + "x"}), 1)
+	assert.EqualValues(t, verifyCommand([]string{"nope", signed}), 1)
+	assert.EqualValues(t, verifyCommand([]string{signed}), 2)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Random number generator.
+//
+// Created as methods rather than just calling rand.Seed(), etc. directly
+// because I'd like to make a fork of this that uses the ISARA Radiate toolkit
+// RNGs to generate cryptographically secure random numbers. Massive overkill
+// for this sort of application! Until then, the RNG setting picks between
+// math/rand, crypto/rand and a PCG generator.
+//
+// Nothing shares a generator: every request gets its own stream, seeded from
+// the master seed, the channel and the request number, so rolls happening at
+// the same time can't change each other's numbers. (Except crypto/rand, which
+// can't be seeded anyway.)
+// -----------------------------------------------------------------------------
+
+// RNG - Something that rolls numbers.
+type RNG interface {
+	// Intn - Get a random number from [0, n); n must be > 0.
+	Intn(n int) int
+}
+
+// NewRNG - Make the RNG named by the RNG setting: "math", "crypto" or "pcg".
+//
+// Anything else gets math/rand. The seed is ignored by crypto/rand.
+func NewRNG(name string, seed uint64) RNG {
+	switch name {
+	case "crypto":
+		return cryptoRNG{}
+	case "pcg":
+		return NewPCG(seed, 0)
+	default:
+		return mathRNG{rand.New(rand.NewSource(int64(seed)))}
+	}
+}
+
+// SeedRng - Pick a new master seed for the streams.
+func (p *RollyPlugin) SeedRng() {
+	var buffer [8]byte
+	if _, err := crand.Read(buffer[:]); err != nil {
+		p.seed = uint64(time.Now().UnixNano())
+		return
+	}
+
+	p.seed = binary.LittleEndian.Uint64(buffer[:])
+}
+
+// NewStream - Get a copy of the plugin with its own RNG, for one request in a
+// channel.
+func (p *RollyPlugin) NewStream(channelID string) *RollyPlugin {
+	request := atomic.AddUint64(&p.requests, 1)
+
+	return p.WithRNG(NewRNG(p.getConfiguration().RNG, StreamSeed(p.seed, channelID, request)))
+}
+
+// WithRNG - Get a copy of the plugin that rolls with the given RNG.
+//
+// Tests use this with a scripted RNG, or a seeded one.
+func (p *RollyPlugin) WithRNG(rng RNG) *RollyPlugin {
+	return &RollyPlugin{
+		MattermostPlugin: p.MattermostPlugin,
+		router:           p.router,
+		active:           p.active,
+		configuration:    p.getConfiguration(),
+		dicePatterns:     p.dicePatterns,
+		seed:             p.seed,
+		rng:              rng,
+		receiptKey:       p.receiptKey,
+	}
+}
+
+// StreamSeed - Work out the seed for a stream from the master seed, the channel
+// and the request number.
+func StreamSeed(seed uint64, channelID string, request uint64) uint64 {
+	var buffer [8]byte
+
+	hash := sha256.New()
+	binary.LittleEndian.PutUint64(buffer[:], seed)
+	hash.Write(buffer[:])
+	hash.Write([]byte(channelID))
+	binary.LittleEndian.PutUint64(buffer[:], request)
+	hash.Write(buffer[:])
+
+	return binary.LittleEndian.Uint64(hash.Sum(nil))
+}
+
+// GetRandom - Gets a random number from [1, n].
+//
+// Without a stream, this comes straight from crypto/rand.
+func (p *RollyPlugin) GetRandom(n int) int {
+	rng := p.rng
+	if rng == nil {
+		rng = cryptoRNG{}
+	}
+
+	return rng.Intn(n) + 1
+}
+
+// -----------------------------------------------------------------------------
+// math/rand, with a source of its own rather than the global one.
+//
+// Not safe to share, but streams aren't shared.
+// -----------------------------------------------------------------------------
+
+type mathRNG struct {
+	*rand.Rand
+}
+
+// -----------------------------------------------------------------------------
+// crypto/rand.
+//
+// Taking a random uint64 modulo n would favour the low numbers a tiny bit, so
+// anything from the incomplete block at the top of the range is thrown away
+// and drawn again.
+// -----------------------------------------------------------------------------
+
+type cryptoRNG struct{}
+
+func (cryptoRNG) Intn(n int) int {
+	if n <= 0 {
+		panic("invalid argument to Intn")
+	}
+
+	max := uint64(n)
+	limit := ^uint64(0) - (^uint64(0)%max+1)%max
+
+	var buffer [8]byte
+	for {
+		if _, err := crand.Read(buffer[:]); err != nil {
+			// There's nothing sensible to fall back to.
+			panic("crypto/rand failed: " + err.Error())
+		}
+
+		value := binary.LittleEndian.Uint64(buffer[:])
+		if value <= limit {
+			return int(value % max)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// PCG32 (XSH RR), from https://www.pcg-random.org/.
+//
+// Small, fast and much better behaved than math/rand, and the same seed always
+// gives the same numbers.
+// -----------------------------------------------------------------------------
+
+type pcgRNG struct {
+	lock      sync.Mutex
+	state     uint64
+	increment uint64 // Picks the stream; always odd.
+}
+
+// NewPCG - Make a PCG32 generator from a seed and a stream number.
+func NewPCG(seed uint64, stream uint64) RNG {
+	pcg := &pcgRNG{increment: stream<<1 | 1}
+	pcg.next()
+	pcg.state += seed
+	pcg.next()
+
+	return pcg
+}
+
+// next - Step the generator, and get the next 32 bits.
+func (r *pcgRNG) next() uint32 {
+	old := r.state
+	r.state = old*6364136223846793005 + r.increment
+
+	xorShifted := uint32(((old >> 18) ^ old) >> 27)
+	rotation := uint32(old >> 59)
+
+	return xorShifted>>rotation | xorShifted<<((-rotation)&31)
+}
+
+func (r *pcgRNG) Intn(n int) int {
+	if n <= 0 || uint64(n) > 1<<32 {
+		panic("invalid argument to Intn")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// Same trick as cryptoRNG, with 32 bits.
+	max := uint32(n - 1)
+	if max == ^uint32(0) {
+		return int(r.next())
+	}
+	max++
+	threshold := -max % max
+	for {
+		value := r.next()
+		if value >= threshold {
+			return int(value % max)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Scripted rolls, for tests.
+// -----------------------------------------------------------------------------
+
+type scriptedRNG struct {
+	lock  sync.Mutex
+	rolls []int
+	next  int
+}
+
+// NewScriptedRNG - Make an RNG that rolls the given numbers in order, starting
+// again at the beginning when it runs out.
+//
+// The rolls are what GetRandom() returns, like 6 for a six on a d6; rolls
+// bigger than the die wrap around.
+func NewScriptedRNG(rolls ...int) RNG {
+	if len(rolls) == 0 {
+		rolls = []int{1}
+	}
+
+	return &scriptedRNG{rolls: rolls}
+}
+
+func (r *scriptedRNG) Intn(n int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	roll := r.rolls[r.next]
+	r.next = (r.next + 1) % len(r.rolls)
+
+	value := (roll - 1) % n
+	if value < 0 {
+		value += n
+	}
+
+	return value
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Random number generator.
+// -----------------------------------------------------------------------------
+
+// TestSeedRng - Make sure there's a master seed.
+func TestSeedRng(t *testing.T) {
+	p := initTestPlugin(t)
+	p.SeedRng()
+	seed := p.seed
+
+	p.SeedRng()
+	assert.NotEqual(t, p.seed, seed)
+}
+
+// TestGetRandom - Make sure GetRandom() is returning values.
+func TestGetRandom(t *testing.T) {
+	p := initTestPlugin(t)
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+
+	val := p.GetRandom(1)
+	assert.EqualValues(t, val, 1)
+
+	val = p.GetRandom(6)
+	assert.True(t, val >= 1 && val <= 6)
+	assert.EqualValues(t, val, 1)
+
+	// Any RNG can be plugged in.
+	p = p.WithRNG(NewScriptedRNG(4, 2))
+	assert.EqualValues(t, p.GetRandom(6), 4)
+	assert.EqualValues(t, p.GetRandom(6), 2)
+	assert.EqualValues(t, p.GetRandom(6), 4)
+
+	// Without one, it still works.
+	val = initTestPlugin(t).GetRandom(6)
+	assert.True(t, val >= 1 && val <= 6)
+}
+
+// TestNewRNG - Make sure the RNG setting picks the right generator.
+func TestNewRNG(t *testing.T) {
+	assert.IsType(t, NewRNG("", 0), mathRNG{})
+	assert.IsType(t, NewRNG("math", 0), mathRNG{})
+	assert.IsType(t, NewRNG("crypto", 0), cryptoRNG{})
+	assert.IsType(t, NewRNG("pcg", 0), &pcgRNG{})
+	assert.IsType(t, NewRNG("nonsense", 0), mathRNG{})
+}
+
+// TestNewStream - Make sure each request gets its own stream.
+func TestNewStream(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+	p.setConfiguration(&configuration{RNG: "pcg"})
+
+	first, second := p.NewStream("channel"), p.NewStream("channel")
+	assert.IsType(t, first.rng, &pcgRNG{})
+	assert.Nil(t, p.rng)
+	assert.EqualValues(t, p.requests, 2)
+
+	// Streams still roll like the plugin.
+	total := first.RollOne("1d20+0").Total
+	assert.True(t, total >= 1 && total <= 20)
+	assert.EqualValues(t, second.getConfiguration().RNG, "pcg")
+
+	// Rolling in other streams at the same time doesn't change this one.
+	done := make(chan bool)
+	go func() {
+		for idx := 0; idx < 100; idx++ {
+			first.GetRandom(20)
+		}
+		done <- true
+	}()
+	for idx := 0; idx < 100; idx++ {
+		p.NewStream("other").GetRandom(20)
+	}
+	<-done
+
+	rolls := make([]int, 10)
+	for idx := range rolls {
+		rolls[idx] = second.GetRandom(1000)
+	}
+
+	// The same seed, channel and request always rolls the same.
+	replay := initTestPlugin(t)
+	replay.setConfiguration(&configuration{RNG: "pcg"})
+	replay.requests = 1
+	stream := replay.NewStream("channel")
+	for idx := range rolls {
+		assert.EqualValues(t, stream.GetRandom(1000), rolls[idx])
+	}
+}
+
+// TestStreamSeed - Make sure streams get different seeds.
+func TestStreamSeed(t *testing.T) {
+	seed := StreamSeed(1, "channel", 1)
+	assert.EqualValues(t, StreamSeed(1, "channel", 1), seed)
+	assert.NotEqual(t, StreamSeed(2, "channel", 1), seed)
+	assert.NotEqual(t, StreamSeed(1, "other", 1), seed)
+	assert.NotEqual(t, StreamSeed(1, "channel", 2), seed)
+}
+
+// TestRNGRange - Make sure every generator stays in range and hits every value.
+func TestRNGRange(t *testing.T) {
+	for _, rng := range []RNG{NewRNG("math", 1), cryptoRNG{}, NewPCG(42, 54)} {
+		assert.EqualValues(t, rng.Intn(1), 0)
+
+		counts := make([]int, 6)
+		for idx := 0; idx < 6000; idx++ {
+			value := rng.Intn(6)
+			assert.True(t, value >= 0 && value < 6)
+			counts[value]++
+		}
+		for _, count := range counts {
+			// Very loose; this is a smoke test, not a fairness test.
+			assert.True(t, count > 800 && count < 1200, "%T rolled %v", rng, counts)
+		}
+
+		// Big ones work too.
+		value := rng.Intn(1 << 30)
+		assert.True(t, value >= 0 && value < 1<<30)
+	}
+}
+
+// TestPCG - Make sure the PCG matches the reference implementation.
+func TestPCG(t *testing.T) {
+	// pcg32-demo's first numbers for seed 42, stream 54.
+	pcg := NewPCG(42, 54).(*pcgRNG)
+	assert.EqualValues(t, pcg.next(), 0xa15c02b7)
+	assert.EqualValues(t, pcg.next(), 0x7b47f409)
+	assert.EqualValues(t, pcg.next(), 0xba1d3330)
+
+	// The same seed always gives the same rolls.
+	first, second := NewPCG(1, 2), NewPCG(1, 2)
+	for idx := 0; idx < 10; idx++ {
+		assert.EqualValues(t, first.Intn(20), second.Intn(20))
+	}
+}
+
+// TestScriptedRNG - Make sure tests can script their rolls.
+func TestScriptedRNG(t *testing.T) {
+	rng := NewScriptedRNG(6, 1, 8)
+	assert.EqualValues(t, rng.Intn(6), 5)
+	assert.EqualValues(t, rng.Intn(6), 0)
+	assert.EqualValues(t, rng.Intn(6), 1) // 8 wraps around on a d6.
+	assert.EqualValues(t, rng.Intn(6), 5)
+
+	assert.EqualValues(t, NewScriptedRNG().Intn(20), 0)
+
+	p := initTestPlugin(t)
+	p.Init()
+	p = p.WithRNG(NewScriptedRNG(6, 3, 2, 4, 17))
+
+	assert.EqualValues(t, p.HandleRoll("3d6!", ""), `"3d6!" [2 3 6 4] = **15**`)
+	assert.EqualValues(t, p.HandleRoll("1d20+5", ""), `"1d20+5" = **22**`)
+}
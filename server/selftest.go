@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// RNG self-test.
+//
+// "The d20 hates me." Rolls a die lots of times with the same generator the
+// dice use, and checks that every face comes up about as often as it should
+// (chi-square) and that high and low rolls don't clump together (runs above
+// and below the mean). Either p-value below selfTestAlpha fails the test;
+// a fair RNG fails about once in 500 tests.
+// -----------------------------------------------------------------------------
+
+const (
+	selfTestSides   int     = 20      // Default die.
+	selfTestRolls   int     = 100000  // Default number of rolls.
+	selfTestMaxRoll int     = 1000000 // Most rolls for one test.
+	selfTestAlpha   float64 = 0.001   // Smallest p-value that passes.
+)
+
+// SelfTestResult - What the self-test found.
+type SelfTestResult struct {
+	Sides  int
+	Rolls  int
+	Counts []int // How often each face came up; Counts[0] is for 1.
+	Mean   float64
+
+	ChiSquare  float64
+	ChiSquareP float64
+
+	Runs         int // Runs of rolls above or below the mean.
+	RunsExpected float64
+	RunsZ        float64
+	RunsP        float64
+
+	Passed bool
+}
+
+// SelfTest - Roll a die lots of times, and check the results look random.
+func (p *RollyPlugin) SelfTest(sides int, rolls int) SelfTestResult {
+	result := SelfTestResult{Sides: sides, Rolls: rolls, Counts: make([]int, sides)}
+
+	mean := float64(sides+1) / 2
+	total := 0
+	above, below := 0, 0
+	last := 0 // 1 above the mean, -1 below, 0 nothing yet.
+	for idx := 0; idx < rolls; idx++ {
+		value := p.GetRandom(sides)
+		result.Counts[value-1]++
+		total += value
+
+		// Rolls right on the mean (on odd dice) don't count for runs.
+		side := 0
+		if float64(value) > mean {
+			side = 1
+			above++
+		} else if float64(value) < mean {
+			side = -1
+			below++
+		}
+		if side != 0 && side != last {
+			result.Runs++
+			last = side
+		}
+	}
+	result.Mean = float64(total) / float64(rolls)
+
+	expected := float64(rolls) / float64(sides)
+	for _, count := range result.Counts {
+		result.ChiSquare += (float64(count) - expected) * (float64(count) - expected) / expected
+	}
+	result.ChiSquareP = ChiSquareP(result.ChiSquare, sides-1)
+
+	// Wald-Wolfowitz runs test.
+	n1, n2 := float64(above), float64(below)
+	result.RunsExpected = 2*n1*n2/(n1+n2) + 1
+	variance := 2 * n1 * n2 * (2*n1*n2 - n1 - n2) / ((n1 + n2) * (n1 + n2) * (n1 + n2 - 1))
+	if variance > 0 {
+		result.RunsZ = (float64(result.Runs) - result.RunsExpected) / math.Sqrt(variance)
+	}
+	result.RunsP = math.Erfc(math.Abs(result.RunsZ) / math.Sqrt2)
+
+	result.Passed = result.ChiSquareP >= selfTestAlpha && result.RunsP >= selfTestAlpha
+
+	return result
+}
+
+// String - Summarize the self-test, with a verdict.
+func (r SelfTestResult) String() string {
+	low, high := 0, 0
+	for face, count := range r.Counts {
+		if count < r.Counts[low] {
+			low = face
+		}
+		if count > r.Counts[high] {
+			high = face
+		}
+	}
+
+	lines := []string{
+		fmt.Sprintf("%d rolls of d%d: mean %.3f (expected %.1f).", r.Rolls, r.Sides, r.Mean, float64(r.Sides+1)/2),
+		fmt.Sprintf("Rarest face %d (%d times), commonest face %d (%d times), expected %.1f times each.",
+			low+1, r.Counts[low], high+1, r.Counts[high], float64(r.Rolls)/float64(r.Sides)),
+		fmt.Sprintf("%v Chi-square: χ² = %.2f with %d degrees of freedom, p = %.4f.", passMark(r.ChiSquareP), r.ChiSquare, r.Sides-1, r.ChiSquareP),
+		fmt.Sprintf("%v Runs: %d runs above and below the mean (expected %.1f), z = %.2f, p = %.4f.", passMark(r.RunsP), r.Runs, r.RunsExpected, r.RunsZ, r.RunsP),
+	}
+	if r.Passed {
+		lines = append(lines, "**Pass:** nothing looks biased.")
+	} else {
+		lines = append(lines, fmt.Sprintf("**Fail:** the dice look biased (p < %v).", selfTestAlpha))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// passMark - ✅ or ❌ for a p-value.
+func passMark(pValue float64) string {
+	if pValue >= selfTestAlpha {
+		return "✅"
+	}
+
+	return "❌"
+}
+
+// selfTestRoller - Get something that rolls the way requests do, and the name
+// of its RNG.
+func (p *RollyPlugin) selfTestRoller() (*RollyPlugin, string) {
+	if p.getConfiguration().ProvablyFair {
+		return p.WithRNG(NewFairRNG(NewSeed(), "selftest", "selftest", 0)), "provably fair"
+	}
+
+	name := p.getConfiguration().RNG
+	if name != "crypto" && name != "pcg" {
+		name = "math"
+	}
+
+	return p.NewStream("selftest"), name
+}
+
+// SelfTestCommand - Run the self-test for a System Admin, like "d20 100000".
+func (p *RollyPlugin) SelfTestCommand(userID string, args string) (*model.CommandResponse, *model.AppError) {
+	response := &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		Username:     pluginName,
+		IconURL:      iconURI,
+	}
+
+	if !p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM) {
+		response.Text = "Only System Admins can run the self-test."
+		return response, nil
+	}
+
+	sides, rolls := selfTestSides, selfTestRolls
+	for _, arg := range strings.Fields(strings.ToLower(args)) {
+		if strings.HasPrefix(arg, "d") {
+			value, err := strconv.Atoi(arg[1:])
+			if err != nil || value < 2 || value > 1000 {
+				response.Text = fmt.Sprintf("I can only test dice from d2 to d1000, not %q.", arg)
+				return response, nil
+			}
+			sides = value
+		} else {
+			value, err := strconv.Atoi(arg)
+			if err != nil || value < 1 || value > selfTestMaxRoll {
+				response.Text = fmt.Sprintf("I can roll from 1 to %d times, not %q.", selfTestMaxRoll, arg)
+				return response, nil
+			}
+			rolls = value
+		}
+	}
+	if rolls < 5*sides {
+		// Chi-square needs about 5 of each face to mean anything.
+		response.Text = fmt.Sprintf("Testing a d%d needs at least %d rolls.", sides, 5*sides)
+		return response, nil
+	}
+
+	roller, name := p.selfTestRoller()
+	response.Text = fmt.Sprintf("🧪 Self-test of the %v RNG.\n%v", name, roller.SelfTest(sides, rolls))
+
+	return response, nil
+}
+
+// CheckRNG - Run the self-test once, and warn if the dice look biased.
+func (p *RollyPlugin) CheckRNG() {
+	roller, name := p.selfTestRoller()
+
+	result := roller.SelfTest(selfTestSides, selfTestRolls)
+	if !result.Passed {
+		p.API.LogWarn("The "+name+" RNG looks biased.", "selftest", result.String())
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Statistics.
+// -----------------------------------------------------------------------------
+
+// ChiSquareP - Get the chance of a chi-square statistic at least this big,
+// with this many degrees of freedom.
+func ChiSquareP(chiSquare float64, degrees int) float64 {
+	if chiSquare <= 0 {
+		return 1
+	}
+
+	return upperGamma(float64(degrees)/2, chiSquare/2)
+}
+
+// upperGamma - The regularized upper incomplete gamma function, Q(a, x).
+//
+// From Numerical Recipes: a series when x is small, a continued fraction
+// when it's big.
+func upperGamma(a float64, x float64) float64 {
+	lgamma, _ := math.Lgamma(a)
+	scale := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1.0; n < 1000; n++ {
+			term *= x / (a + n)
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+
+		return math.Max(0, 1-sum*scale)
+	}
+
+	// Lentz's method.
+	tiny := 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1.0; n < 1000; n++ {
+		an := -n * (n - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+
+	return scale * h
+}
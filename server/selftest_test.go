@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/mattermost/mattermost-server/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - RNG self-test.
+// -----------------------------------------------------------------------------
+
+// TestChiSquareP - Compare with a table of critical values.
+func TestChiSquareP(t *testing.T) {
+	for _, test := range []struct {
+		chiSquare float64
+		degrees   int
+		p         float64
+	}{
+		{3.841, 1, 0.05},
+		{6.635, 1, 0.01},
+		{18.307, 10, 0.05},
+		{30.144, 19, 0.05},
+		{43.820, 19, 0.001},
+		{7.633, 19, 0.99},
+	} {
+		assert.InDelta(t, ChiSquareP(test.chiSquare, test.degrees), test.p, 0.0005, "%v", test)
+	}
+
+	assert.EqualValues(t, ChiSquareP(0, 5), 1)
+	assert.True(t, ChiSquareP(1000, 19) < 1e-100)
+}
+
+// TestSelfTest - Fair dice pass, loaded dice don't.
+func TestSelfTest(t *testing.T) {
+	p := initTestPlugin(t)
+	p = p.WithRNG(NewRNG("math", 0)) // Make these deterministic.
+
+	result := p.SelfTest(20, 100000)
+	assert.True(t, result.Passed)
+	assert.EqualValues(t, len(result.Counts), 20)
+	assert.InDelta(t, result.Mean, 10.5, 0.05)
+	assert.True(t, result.ChiSquareP >= selfTestAlpha)
+	assert.True(t, result.RunsP >= selfTestAlpha)
+	assert.InDelta(t, float64(result.Runs), result.RunsExpected, 500)
+	assert.True(t, strings.HasSuffix(result.String(), "\n**Pass:** nothing looks biased."))
+
+	// The d20 really does hate you.
+	result = p.WithRNG(NewScriptedRNG(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 1)).SelfTest(20, 20000)
+	assert.False(t, result.Passed)
+	assert.True(t, result.ChiSquareP < selfTestAlpha)
+	assert.True(t, strings.HasSuffix(result.String(), "\n**Fail:** the dice look biased (p < 0.001)."))
+
+	// Every face equally often, but in order.
+	result = p.WithRNG(NewScriptedRNG(1, 2, 3, 4, 5, 6)).SelfTest(6, 6000)
+	assert.EqualValues(t, result.ChiSquare, 0)
+	assert.EqualValues(t, result.Runs, 2000)
+	assert.True(t, result.RunsP < selfTestAlpha)
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.String(), "✅ Chi-square: χ² = 0.00 with 5 degrees of freedom, p = 1.0000.\n❌ Runs: 2000 runs above and below the mean (expected 3001.0), z = -25.85")
+
+	// Odd dice don't count the middle face for runs.
+	result = p.WithRNG(NewScriptedRNG(1, 2, 3)).SelfTest(3, 300)
+	assert.EqualValues(t, result.Runs, 200)
+	assert.False(t, math.IsNaN(result.RunsZ))
+}
+
+// TestSelfTestCommand - Only System Admins can run it.
+func TestSelfTestCommand(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+
+	run := func(userID string, cmd string) string {
+		resp, err := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{Command: cmd, UserId: userID})
+		assert.Nil(t, err)
+		assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+		return resp.Text
+	}
+
+	assert.EqualValues(t, run("userid", "/roll selftest d20 100000"), "Only System Admins can run the self-test.")
+
+	text := run("adminid", "/roll selftest")
+	assert.True(t, strings.HasPrefix(text, "🧪 Self-test of the math RNG.\n100000 rolls of d20: mean "))
+
+	p.setConfiguration(&configuration{RNG: "pcg"})
+	text = run("adminid", "/roll selftest d6 6000")
+	assert.True(t, strings.HasPrefix(text, "🧪 Self-test of the pcg RNG.\n6000 rolls of d6: mean "))
+	assert.Contains(t, text, "with 5 degrees of freedom")
+
+	p.setConfiguration(&configuration{ProvablyFair: true})
+	text = run("adminid", "/roll selftest 1000 D10")
+	assert.True(t, strings.HasPrefix(text, "🧪 Self-test of the provably fair RNG.\n1000 rolls of d10: mean "))
+
+	assert.EqualValues(t, run("adminid", "/roll selftest d1"), `I can only test dice from d2 to d1000, not "d1".`)
+	assert.EqualValues(t, run("adminid", "/roll selftest dx"), `I can only test dice from d2 to d1000, not "dx".`)
+	assert.EqualValues(t, run("adminid", "/roll selftest d20 lots"), `I can roll from 1 to 1000000 times, not "lots".`)
+	assert.EqualValues(t, run("adminid", "/roll selftest d20 99999999"), `I can roll from 1 to 1000000 times, not "99999999".`)
+	assert.EqualValues(t, run("adminid", "/roll selftest d20 50"), "Testing a d20 needs at least 100 rolls.")
+}
+
+// TestCheckRNG - Fair dice don't get a warning.
+func TestCheckRNG(t *testing.T) {
+	p := initTestPlugin(t)
+	p.CheckRNG()
+
+	p.API.(*plugintest.API).AssertNotCalled(t, "LogWarn", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// Estimated roll statistics.
+//
+// Some rolls can't be worked out exactly (see stats.go): "until" can go on and
+// on, "nat" and rolled dice counts tie the parts of a roll together, and some
+// rolls are just too big. Those get rolled over and over instead, by a few
+// workers with their own streams, until there are StatsSamples rolls or
+// StatsTimeout runs out. The results are estimates, so they come with 95%
+// confidence intervals.
+// -----------------------------------------------------------------------------
+
+const (
+	defaultSamples int           = 100000          // Rolls for an estimate.
+	maxSamples     int           = 10000000        // Most rolls for an estimate.
+	defaultTimeout time.Duration = 2 * time.Second // Longest to spend on an estimate.
+	maxTimeout     time.Duration = 30 * time.Second
+
+	sampleBatch int     = 1000 // Rolls a worker takes on at a time.
+	maxWorkers  int     = 8    // Most workers rolling at once.
+	confidenceZ float64 = 1.96 // For 95% confidence intervals.
+)
+
+// sampler - Something that rolls a roll's total, over and over.
+type sampler func(roller *RollyPlugin) (float64, bool, error)
+
+// rollSampler - Get a sampler for a roll.
+//
+// Expressions are parsed once; anything else goes through RollOne().
+func (p *RollyPlugin) rollSampler(rollArg string) (sampler, error) {
+	if p.vsPattern.MatchString(rollArg) {
+		rollArg = FindNamedSubstrings(p.vsPattern, rollArg)["roll"]
+	}
+
+	if p.isLegacyRoll(rollArg) {
+		return func(roller *RollyPlugin) (float64, bool, error) {
+			result := roller.RollOne(rollArg)
+			if result.Text != "" {
+				return 0, false, errors.New("that can't be rolled")
+			}
+			return result.Total, false, nil
+		}, nil
+	}
+
+	expr, err := p.ParseExpression(rollArg)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(roller *RollyPlugin) (float64, bool, error) {
+		result, _, err := roller.RollExpression(expr)
+		return roller.getConfiguration().ClampTotal(result.value), result.isBool, err
+	}, nil
+}
+
+// isLegacyRoll - Is this one of the rolls the regexes in plugin.go handle,
+// instead of an expression?
+func (p *RollyPlugin) isLegacyRoll(rollArg string) bool {
+	return p.simplePattern.MatchString(rollArg) ||
+		(p.rollPattern.MatchString(rollArg) && !p.isZeroBased(rollArg)) ||
+		p.poolPattern.MatchString(rollArg) ||
+		p.d6Pattern.MatchString(rollArg) ||
+		p.facesPattern.MatchString(rollArg)
+}
+
+// simulateStats - Estimate the distribution of a roll by rolling it lots.
+func (p *RollyPlugin) simulateStats(rollArg string) (*RollStats, error) {
+	roll, err := p.rollSampler(rollArg)
+	if err != nil {
+		return nil, err
+	}
+
+	config := p.getConfiguration()
+	samples := config.Samples()
+	deadline := time.Now().Add(config.Timeout())
+
+	workers := runtime.NumCPU()
+	if workers > maxWorkers {
+		workers = maxWorkers
+	}
+
+	var (
+		claimed  int64 // Rolls the workers have taken on.
+		lock     sync.Mutex
+		counts   = make(map[float64]int)
+		rolled   int
+		isBool   bool
+		timedOut bool
+		rollErr  error
+		wait     sync.WaitGroup
+	)
+
+	for idx := 0; idx < workers; idx++ {
+		wait.Add(1)
+		go func(roller *RollyPlugin) {
+			defer wait.Done()
+
+			mine := make(map[float64]int)
+			done, yesNo := 0, false
+			var err error
+			for err == nil {
+				start := int(atomic.AddInt64(&claimed, int64(sampleBatch))) - sampleBatch
+				if start >= samples {
+					break
+				}
+
+				for n := start; n < start+sampleBatch && n < samples && err == nil; n++ {
+					var value float64
+					value, yesNo, err = roll(roller)
+					mine[distributionKey(value)]++
+					done++
+				}
+
+				if time.Now().After(deadline) {
+					lock.Lock()
+					timedOut = true
+					lock.Unlock()
+					break
+				}
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			for value, count := range mine {
+				counts[value] += count
+			}
+			rolled += done
+			isBool = isBool || yesNo
+			if err != nil {
+				rollErr = err
+			}
+		}(p.NewStream("stats"))
+	}
+	wait.Wait()
+
+	if rollErr != nil {
+		return nil, rollErr
+	}
+
+	totals := Distribution{}
+	for value, count := range counts {
+		totals[value] = float64(count) / float64(rolled)
+	}
+
+	return &RollStats{Totals: totals, IsBool: isBool, Samples: rolled, TimedOut: timedOut && rolled < samples}, nil
+}
+
+// MeanMargin - How far the estimated mean could be off, with 95% confidence.
+func (s *RollStats) MeanMargin() float64 {
+	if s.Exact || s.Samples == 0 {
+		return 0
+	}
+
+	return confidenceZ * s.Totals.StdDev() / math.Sqrt(float64(s.Samples))
+}
+
+// ChanceInterval - Where an estimated chance could really be, with 95%
+// confidence.
+//
+// Uses the Wilson score interval, which behaves near 0% and 100%; returns the
+// low and high ends.
+func (s *RollStats) ChanceInterval(chance float64) (float64, float64) {
+	if s.Exact || s.Samples == 0 {
+		return chance, chance
+	}
+
+	n := float64(s.Samples)
+	z2 := confidenceZ * confidenceZ
+	center := (chance + z2/(2*n)) / (1 + z2/n)
+	margin := confidenceZ / (1 + z2/n) * math.Sqrt(chance*(1-chance)/n+z2/(4*n*n))
+
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
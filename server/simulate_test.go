@@ -0,0 +1,132 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Estimated roll statistics.
+// -----------------------------------------------------------------------------
+
+// TestSimulateStats - Make sure rolls that can't be worked out get estimated.
+func TestSimulateStats(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+	p.setConfiguration(&configuration{StatsSamples: "20000"})
+
+	for _, test := range []struct {
+		roll string
+		mean float64
+	}{
+		{"1d6 until 6", 6},
+		{"(1d4)d6", 8.75},
+		{"1d20 >= 11 ? nat : 0", 7.75},
+		{"2d(1d8)", 5.625}, // 1d8 sides, but at least 2.
+	} {
+		stats, err := p.Stats(test.roll)
+		if assert.Nil(t, err, test.roll) {
+			assert.False(t, stats.Exact, test.roll)
+			assert.EqualValues(t, stats.Samples, 20000, test.roll)
+			assert.False(t, stats.TimedOut, test.roll)
+
+			// Two margins is about four standard errors; this fails about once in
+			// 16000 runs.
+			assert.InDelta(t, stats.Totals.Mean(), test.mean, 2*stats.MeanMargin(), test.roll)
+		}
+	}
+
+	// Yes or no.
+	stats, err := p.Stats("(1d4)d6 >= 10")
+	assert.Nil(t, err)
+	assert.True(t, stats.IsBool)
+	low, high := stats.ChanceInterval(stats.Totals.AtLeast(1))
+	assert.True(t, low < stats.Totals.AtLeast(1) && stats.Totals.AtLeast(1) < high)
+
+	// Too big to work out, so estimated.
+	stats, err = p.Stats("100d100<50")
+	assert.Nil(t, err)
+	assert.False(t, stats.Exact)
+
+	// Still can't be rolled.
+	_, err = p.Stats("1d6 until nat")
+	assert.EqualValues(t, err.Error(), "nat needs a die rolled before it")
+}
+
+// TestSimulateTimeout - Make sure estimates give up in time.
+func TestSimulateTimeout(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+	p.setConfiguration(&configuration{StatsSamples: "10000000", StatsTimeout: "0.000001"})
+
+	stats, err := p.Stats("1d6 until 6")
+	assert.Nil(t, err)
+	assert.True(t, stats.TimedOut)
+	assert.True(t, stats.Samples > 0 && stats.Samples < 10000000)
+	assert.Contains(t, stats.Title(), "(it ran out of time)")
+}
+
+// TestChanceInterval - Check the Wilson score interval against a worked
+// example.
+func TestChanceInterval(t *testing.T) {
+	stats := &RollStats{Samples: 100}
+	low, high := stats.ChanceInterval(0.5)
+	assert.InDelta(t, low, 0.4038, 0.0001)
+	assert.InDelta(t, high, 0.5962, 0.0001)
+
+	low, high = stats.ChanceInterval(0)
+	assert.EqualValues(t, low, 0)
+	assert.InDelta(t, high, 0.0370, 0.0001)
+
+	stats.Exact = true
+	low, high = stats.ChanceInterval(0.5)
+	assert.EqualValues(t, []float64{low, high}, []float64{0.5, 0.5})
+}
+
+// TestStatsSettings - Make sure the settings are read, or the defaults used.
+func TestStatsSettings(t *testing.T) {
+	config := &configuration{}
+	assert.EqualValues(t, config.Samples(), defaultSamples)
+	assert.EqualValues(t, config.Timeout(), defaultTimeout)
+
+	config = &configuration{StatsSamples: " 5000 ", StatsTimeout: "0.5"}
+	assert.EqualValues(t, config.Samples(), 5000)
+	assert.EqualValues(t, config.Timeout().Seconds(), 0.5)
+
+	config = &configuration{StatsSamples: "999999999", StatsTimeout: "3600"}
+	assert.EqualValues(t, config.Samples(), maxSamples)
+	assert.EqualValues(t, config.Timeout(), maxTimeout)
+
+	config = &configuration{StatsSamples: "lots", StatsTimeout: "-1"}
+	assert.EqualValues(t, config.Samples(), defaultSamples)
+	assert.EqualValues(t, config.Timeout(), defaultTimeout)
+}
+
+// TestEstimatedStatsCommand - Make sure estimates say so.
+func TestEstimatedStatsCommand(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+	p.setConfiguration(&configuration{StatsSamples: "10000"})
+
+	resp, err := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{Command: "/roll stats 1d6 until 6 vs 3,50"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.Regexp(t, regexp.MustCompile(`^📊 Stats for "1d6 until >= 6", estimated from 10000 rolls with 95% confidence intervals:
+Mean \*\*[0-9.]+\*\* \([0-9.]+ to [0-9.]+\), standard deviation [0-9.]+, from 1 to [0-9]+\.
+Percentiles: 10%: 1, 25%: 2, 50%: 4, 75%: [0-9]+, 90%: [0-9]+\.
+`+"```"+`
+  1-2 │█+ [0-9.]+%
+(?s:.+)
+`+"```"+`
+
+\| Target \| Chance \|
+\|---:\|---:\|
+\| ≥ 3 \| [0-9.]+% \([0-9.]+% to [0-9.]+%\) \|
+\| ≥ 50 \| .+ \|
+
+📈 \[Bar chart\]\(/plugins/ca.taffer.mm-rolly/stats/chart.png\?roll=1d6\+until\+%3E%3D\+6\)$`), resp.Text)
+}
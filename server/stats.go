@@ -0,0 +1,583 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// -----------------------------------------------------------------------------
+// Roll statistics.
+//
+// "/roll stats 4d6kh3" works out the exact distribution of a roll (see
+// distribution.go) and shows its mean, standard deviation, range and
+// percentiles, a histogram (see chart.go), and the chance of beating any
+// targets given with "vs". This follows the same path as RollOne(), without
+// rolling anything; rolls that can't be worked out exactly are estimated
+// instead (see simulate.go).
+//
+// Distributions are cached by the normalized roll, so "d20" and "1d20" share
+// one; the cache is emptied when the settings change.
+// -----------------------------------------------------------------------------
+
+const maxCachedStats int = 100 // Most distributions to remember.
+
+// Percentiles to show.
+var statsPercentiles = []float64{10, 25, 50, 75, 90}
+
+// RollStats - The distribution of a roll's totals.
+type RollStats struct {
+	Roll   string // What was worked out, like "4d6kh3".
+	Totals Distribution
+	IsBool bool // Is it a yes (1) or no (0)?
+
+	// Estimates; see simulate.go.
+	Exact    bool // Worked out exactly, instead of estimated?
+	Samples  int  // Rolls the estimate is from.
+	TimedOut bool // Did it run out of time before rolling StatsSamples times?
+}
+
+// Stats - Work out the distribution of a roll, or remember it.
+func (p *RollyPlugin) Stats(rollArg string) (*RollStats, error) {
+	return p.stats(rollArg, true)
+}
+
+// ExactStats - Work out the exact distribution of a roll, or remember it;
+// rolls that would have to be estimated give errInexact (or errTooWide).
+func (p *RollyPlugin) ExactStats(rollArg string) (*RollStats, error) {
+	return p.stats(rollArg, false)
+}
+
+// stats - Work out the distribution of a roll, estimating it if that's okay.
+func (p *RollyPlugin) stats(rollArg string, estimate bool) (*RollStats, error) {
+	roll := p.Normalize(rollArg)
+
+	p.statsLock.Lock()
+	stats, ok := p.statsCache[roll]
+	p.statsLock.Unlock()
+	if ok && !estimate && !stats.Exact {
+		return nil, errInexact
+	}
+	if ok {
+		return stats, nil
+	}
+
+	stats, err := p.exactStats(rollArg)
+	if (err == errInexact || err == errTooWide) && estimate {
+		stats, err = p.simulateStats(rollArg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stats.Roll = roll
+
+	p.statsLock.Lock()
+	if p.statsCache == nil || len(p.statsCache) >= maxCachedStats {
+		p.statsCache = make(map[string]*RollStats)
+	}
+	p.statsCache[roll] = stats
+	p.statsLock.Unlock()
+
+	return stats, nil
+}
+
+// clearStats - Forget the cached distributions, because the settings changed.
+func (p *RollyPlugin) clearStats() {
+	p.statsLock.Lock()
+	defer p.statsLock.Unlock()
+
+	p.statsCache = nil
+}
+
+// exactStats - Work out the exact distribution of a roll.
+func (p *RollyPlugin) exactStats(rollArg string) (*RollStats, error) {
+	switch {
+	case p.comboPattern.MatchString(rollArg), p.repeatPattern.MatchString(rollArg), p.damagePattern.MatchString(rollArg):
+		return nil, errors.New("I can only work out the odds of a single total")
+	case p.vsPattern.MatchString(rollArg):
+		return p.exactStats(FindNamedSubstrings(p.vsPattern, rollArg)["roll"])
+	case p.simplePattern.MatchString(rollArg):
+		die, err := legacyDie(FindNamedSubstrings(p.simplePattern, rollArg)["num_sides"])
+		if err != nil {
+			return nil, err
+		}
+
+		return &RollStats{Totals: die, Exact: true}, nil
+	case p.rollPattern.MatchString(rollArg) && !p.isZeroBased(rollArg):
+		return p.rollStats(FindNamedSubstrings(p.rollPattern, rollArg))
+	case p.poolPattern.MatchString(rollArg):
+		return p.poolStats(rollArg)
+	case p.d6Pattern.MatchString(rollArg):
+		return p.d6Stats(FindNamedSubstrings(p.d6Pattern, rollArg))
+	case p.facesPattern.MatchString(rollArg):
+		return p.facesStats(FindNamedSubstrings(p.facesPattern, rollArg))
+	}
+
+	expr, err := p.ParseExpression(rollArg)
+	if err != nil {
+		return nil, err
+	}
+
+	totals, err := expr.distribution(&exprContext{p: p})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RollStats{Totals: totals.Map(p.getConfiguration().ClampTotal), IsBool: isBoolNode(expr), Exact: true}, nil
+}
+
+// legacyDie - One die with sides like RollDice() takes, like "6", "%" or "F".
+func legacyDie(sides string) (Distribution, error) {
+	if oneSided(sides) {
+		return nil, errors.New("a one-sided die rolls off into the shadows")
+	}
+
+	switch sides, _ = clampSides(sides, nil); sides {
+	case "%":
+		return RangeDistribution(1, 100), nil
+	case "F":
+		return RangeDistribution(-1, 1), nil
+	}
+
+	value, _ := strconv.Atoi(sides)
+	if !rangeFits(1, value) {
+		return nil, errTooWide
+	}
+
+	return RangeDistribution(1, value), nil
+}
+
+// rollStats - Work out a typical roll, like RollDice().
+func (p *RollyPlugin) rollStats(matches map[string]string) (*RollStats, error) {
+	numDice, _ := clampDice(matches["num_dice"], nil)
+	sides := matches["num_sides"]
+	die, err := legacyDie(sides)
+	if err != nil {
+		return nil, err
+	}
+	modifierValue, _ := strconv.Atoi(matches["modifier_value"])
+	value := float64(modifierValue)
+	config := p.getConfiguration()
+
+	var totals Distribution
+	switch matches["modifier"] {
+	case "<": // Ignore the lowest modifierValue rolls.
+		totals, err = KeepDistribution(die, numDice, "dl", min(modifierValue, numDice-1))
+	case ">": // Keep the best modifierValue rolls.
+		totals, err = KeepDistribution(die, numDice, "kh", modifierValue)
+	case "!":
+		totals, err = SumDistribution(ExplodeDistribution(die, die.Max()), numDice)
+	default:
+		totals, err = SumDistribution(die, numDice)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch matches["modifier"] {
+	case "+":
+		totals = totals.Map(func(total float64) float64 { return total + value })
+	case "-":
+		totals = totals.Map(func(total float64) float64 {
+			if sides == "F" {
+				return total - value
+			}
+			return config.ClampTotal(total - value)
+		})
+	case "/":
+		if modifierValue > 0 {
+			totals = totals.Map(func(total float64) float64 { return RoundDivision(total/value, config.DivisionRounding) })
+		}
+	case "x", "*":
+		totals = totals.Map(func(total float64) float64 { return total * value })
+	}
+
+	return &RollStats{Totals: totals, Exact: true}, nil
+}
+
+// poolStats - Work out the successes for a dice pool, like RollPool().
+//
+// Rerolls aren't capped at maxDice, which hardly ever matters.
+func (p *RollyPlugin) poolStats(rollArg string) (*RollStats, error) {
+	matches := FindNamedSubstrings(p.poolPattern, rollArg)
+	numDice, _ := clampDice(matches["num_dice"], nil)
+	rules, _, _ := p.parsePoolMods(matches)
+
+	totals, err := SumDistribution(PoolDieDistribution(rules.again, rules.target, rules.rote, rules.double), numDice)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RollStats{Totals: totals, Exact: true}, nil
+}
+
+// d6Stats - Work out a D6 System roll: some d6, and a wild die that explodes.
+func (p *RollyPlugin) d6Stats(matches map[string]string) (*RollStats, error) {
+	numDice, _ := clampDice(matches["num_dice"], nil)
+	pips, _ := strconv.Atoi(matches["modifier_value"])
+	if matches["modifier"] == "-" {
+		pips = -pips
+	}
+
+	d6 := RangeDistribution(1, 6)
+	dice, err := SumDistribution(d6, numDice-1)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := AddDistributions(dice, ExplodeDistribution(d6, 6))
+	if err != nil {
+		return nil, err
+	}
+
+	return &RollStats{Totals: totals.Map(func(total float64) float64 { return total + float64(pips) }), Exact: true}, nil
+}
+
+// facesStats - Work out dice with custom faces, as long as they're numbers.
+func (p *RollyPlugin) facesStats(matches map[string]string) (*RollStats, error) {
+	faces := SplitFaces(matches["faces"])
+	if named, ok := p.getConfiguration().customDice[strings.ToLower(strings.TrimSpace(matches["faces"]))]; ok {
+		faces = named
+	}
+
+	var values []int
+	for _, face := range faces {
+		value, err := strconv.Atoi(face)
+		if err != nil {
+			return nil, errors.New("only dice with numbers on them add up")
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return nil, errors.New("that die has no faces")
+	}
+
+	numDice, _ := clampDice(matches["num_dice"], nil)
+	totals, err := SumDistribution(FacesDistribution(values), numDice)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RollStats{Totals: totals, Exact: true}, nil
+}
+
+// Title - Say what the stats are for, and how they were worked out.
+func (s *RollStats) Title() string {
+	if s.Exact {
+		return fmt.Sprintf("📊 Stats for %q, worked out exactly:", s.Roll)
+	}
+
+	title := fmt.Sprintf("📊 Stats for %q, estimated from %d rolls", s.Roll, s.Samples)
+	if s.TimedOut {
+		title += " (it ran out of time)"
+	}
+
+	return title + " with 95% confidence intervals:"
+}
+
+// String - Summarize the stats, like "Mean **12.24**, ...".
+func (s *RollStats) String() string {
+	if s.IsBool {
+		return fmt.Sprintf("Chance of yes: **%v**.", s.FormatChance(s.Totals.AtLeast(1)))
+	}
+
+	mean := fmt.Sprintf("**%v**%v", FormatValue(s.Totals.Mean()), s.meanInterval())
+
+	var percentiles []string
+	for _, percent := range statsPercentiles {
+		percentiles = append(percentiles, fmt.Sprintf("%v%%: %v", percent, FormatValue(s.Totals.Percentile(percent))))
+	}
+
+	return fmt.Sprintf("Mean %v, standard deviation %v, from %v to %v.\nPercentiles: %v.",
+		mean, FormatValue(s.Totals.StdDev()),
+		FormatValue(s.Totals.Min()), FormatValue(s.Totals.Max()), strings.Join(percentiles, ", "))
+}
+
+// meanInterval - Where an estimated mean could really be, like
+// " (12.21 to 12.27)", or nothing if it's exact.
+func (s *RollStats) meanInterval() string {
+	if s.Exact {
+		return ""
+	}
+
+	margin := s.MeanMargin()
+
+	return fmt.Sprintf(" (%v to %v)", FormatValue(s.Totals.Mean()-margin), FormatValue(s.Totals.Mean()+margin))
+}
+
+// FormatChance - Format a chance like FormatChance(), with its confidence
+// interval if it's an estimate, like "42.1% (41.8% to 42.4%)".
+func (s *RollStats) FormatChance(chance float64) string {
+	if s.Exact {
+		return FormatChance(chance)
+	}
+
+	low, high := s.ChanceInterval(chance)
+
+	return fmt.Sprintf("%v (%v to %v)", FormatChance(chance), FormatChance(low), FormatChance(high))
+}
+
+// Targets - The chance of a total of at least each target, like "12,15,18".
+//
+// Returns the lines of a table.
+func (s *RollStats) Targets(targetList string) []string {
+	var lines []string
+
+	targets := strings.Split(targetList, ",")
+	if len(targets) > maxTargets {
+		targets = targets[:maxTargets]
+		lines = append(lines, fmt.Sprintf("That's too many targets, using the first %v.", maxTargets))
+	}
+
+	// Tables need a blank line in front of them.
+	lines = append(lines, "", "| Target | Chance |", "|---:|---:|")
+
+	for _, target := range targets {
+		value, _ := strconv.Atoi(strings.TrimSpace(target))
+		lines = append(lines, fmt.Sprintf("| ≥ %d | %v |", value, s.FormatChance(s.Totals.AtLeast(float64(value)))))
+	}
+
+	return lines
+}
+
+// FormatChance - Format a chance as a percentage, like 42.1%.
+//
+// Long shots aren't rounded to 0% (or sure things to 100%) unless they are.
+func FormatChance(chance float64) string {
+	switch {
+	case chance > 0 && chance < 0.0005:
+		return "< 0.1%"
+	case chance < 1 && chance > 0.9995:
+		return "> 99.9%"
+	}
+
+	return strconv.FormatFloat(math.Round(chance*1000)/10, 'f', -1, 64) + "%"
+}
+
+// StatsCommand - Show the stats for a roll, like "4d6kh3 vs 12,15".
+func (p *RollyPlugin) StatsCommand(rollArg string) (*model.CommandResponse, *model.AppError) {
+	response := &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_IN_CHANNEL,
+		Username:     pluginName,
+		IconURL:      iconURI,
+	}
+
+	if rollArg == "" {
+		response.ResponseType = model.COMMAND_RESPONSE_TYPE_EPHEMERAL
+		response.Text = "Which roll? Like `/roll stats 4d6kh3`."
+		return response, nil
+	}
+
+	roll, targets := rollArg, ""
+	if p.vsPattern.MatchString(rollArg) {
+		matches := FindNamedSubstrings(p.vsPattern, rollArg)
+		roll, targets = matches["roll"], matches["targets"]
+	}
+
+	stats, err := p.Stats(roll)
+	if err != nil {
+		response.ResponseType = model.COMMAND_RESPONSE_TYPE_EPHEMERAL
+		response.Text = fmt.Sprintf("I can't work out the odds of %q: %v.", roll, err)
+		return response, nil
+	}
+
+	lines := []string{stats.Title(), stats.String()}
+	if !stats.IsBool {
+		lines = append(lines, stats.Totals.Histogram())
+		if targets != "" {
+			lines = append(lines, stats.Targets(targets)...)
+		}
+		// After a blank line, so it isn't read as part of the table.
+		lines = append(lines, "", fmt.Sprintf("📈 [Bar chart](%v)", ChartURL(stats.Roll)))
+	}
+	response.Text = strings.Join(lines, "\n")
+
+	return response, nil
+}
+
+// -----------------------------------------------------------------------------
+// Exact distributions of expressions.
+//
+// The parts of an expression are rolled separately, so their distributions
+// can be combined as if they're independent. That stops being true once "nat"
+// looks back at a die, or the count or sides of some dice are rolled, and
+// "until" can go on and on, so those give up with errInexact.
+// -----------------------------------------------------------------------------
+
+// isBoolNode - Does this expression answer yes or no?
+func isBoolNode(node exprNode) bool {
+	switch n := node.(type) {
+	case *comparisonNode:
+		return true
+	case *groupNode:
+		return isBoolNode(n.inner)
+	case *conditionalNode:
+		return isBoolNode(n.yes) && isBoolNode(n.no)
+	default:
+		return false
+	}
+}
+
+func (n *numberNode) distribution(ctx *exprContext) (Distribution, error) {
+	return ConstantDistribution(n.value), nil
+}
+
+func (n *naturalNode) distribution(ctx *exprContext) (Distribution, error) {
+	return nil, errInexact
+}
+
+func (n *comparisonNode) distribution(ctx *exprContext) (Distribution, error) {
+	left, err := n.left.distribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.distribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return CombineDistributions(left, right, func(x float64, y float64) float64 {
+		if compare(x, n.op, y) {
+			return 1
+		}
+		return 0
+	})
+}
+
+func (n *untilNode) distribution(ctx *exprContext) (Distribution, error) {
+	return nil, errInexact
+}
+
+func (n *conditionalNode) distribution(ctx *exprContext) (Distribution, error) {
+	condition, err := n.condition.distribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the branches that can happen get worked out.
+	dist := Distribution{}
+	for _, branch := range []struct {
+		node   exprNode
+		chance float64
+	}{{n.yes, 1 - condition[0]}, {n.no, condition[0]}} {
+		if branch.chance <= 0 {
+			continue
+		}
+
+		values, err := branch.node.distribution(ctx)
+		if err != nil {
+			return nil, err
+		}
+		dist.mix(values, branch.chance)
+	}
+
+	return dist, nil
+}
+
+func (n *functionNode) distribution(ctx *exprContext) (Distribution, error) {
+	dist, err := n.args[0].distribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.name {
+	case "floor":
+		return dist.Map(math.Floor), nil
+	case "ceil":
+		return dist.Map(math.Ceil), nil
+	case "round":
+		return dist.Map(math.Round), nil
+	case "abs":
+		return dist.Map(math.Abs), nil
+	}
+
+	pick := math.Min
+	if n.name == "max" {
+		pick = math.Max
+	}
+	for _, arg := range n.args[1:] {
+		values, err := arg.distribution(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if dist, err = CombineDistributions(dist, values, pick); err != nil {
+			return nil, err
+		}
+	}
+
+	return dist, nil
+}
+
+func (n *groupNode) distribution(ctx *exprContext) (Distribution, error) {
+	return n.inner.distribution(ctx)
+}
+
+func (n *negateNode) distribution(ctx *exprContext) (Distribution, error) {
+	dist, err := n.operand.distribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return dist.Map(func(value float64) float64 { return -value }), nil
+}
+
+func (n *binaryNode) distribution(ctx *exprContext) (Distribution, error) {
+	left, err := n.left.distribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.distribution(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "+":
+		return AddDistributions(left, right)
+	case "-":
+		return AddDistributions(left, right.Map(func(value float64) float64 { return -value }))
+	case "*":
+		return CombineDistributions(left, right, func(x float64, y float64) float64 { return x * y })
+	}
+
+	if right[0] > 0 {
+		return nil, errors.New("you can't divide by zero")
+	}
+	rounding, ok := divisionRounding[n.op]
+	if !ok {
+		rounding = ctx.p.getConfiguration().DivisionRounding
+	}
+
+	return CombineDistributions(left, right, func(x float64, y float64) float64 { return RoundDivision(x/y, rounding) })
+}
+
+func (n *labelNode) distribution(ctx *exprContext) (Distribution, error) {
+	return n.labeled.distribution(ctx)
+}
+
+func (n *diceNode) distribution(ctx *exprContext) (Distribution, error) {
+	if !n.isSimple() {
+		return nil, errInexact
+	}
+
+	count := clampCount(int(math.Floor(n.count.(*numberNode).value)))
+	ctx.dice += count
+	if ctx.dice > maxExpressionDice {
+		return nil, fmt.Errorf("that's more than %v dice", maxExpressionDice)
+	}
+
+	var die Distribution
+	switch {
+	case len(n.faces) > 0:
+		die = FacesDistribution(n.faces)
+	case !rangeFits(n.low, n.high):
+		return nil, errTooWide
+	default:
+		die = RangeDistribution(n.low, n.high)
+	}
+
+	return KeepDistribution(die, count, n.keep, n.keepCount)
+}
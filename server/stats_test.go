@@ -0,0 +1,185 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// Tests - Roll statistics.
+// -----------------------------------------------------------------------------
+
+// TestStats - Make sure different sorts of rolls can be worked out.
+func TestStats(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	for _, test := range []struct {
+		roll string
+		mean float64
+		low  float64
+		high float64
+	}{
+		{"20", 10.5, 1, 20},
+		{"%", 50.5, 1, 100},
+		{"4dF", 0, -4, 4},
+		{"2d6+3", 10, 5, 15},
+		{"1d4-2", 0.5, -1, 2},
+		{"2d6x2", 14, 4, 24},
+		{"4d6<1", 12.2446, 3, 18},
+		{"4d6>1", 5.2446, 1, 6},
+		{"3d6!", 12.6, 3, float64(3 * (6*explodeDepth + 6))},
+		{"5d10dd", 2.5, 0, 10},
+		{"d6sys 3D+2", 13.2, 5, float64(6*explodeDepth + 6 + 12 + 2)},
+		{"2d{1,1,2,3,5,8}", 6.6667, 2, 16},
+		{"4d6kh3", 12.2446, 3, 18},
+		{"2d20kl1", 7.175, 1, 20},
+		{"max(1d20, 1d20)+5", 18.825, 6, 25},
+		{"1d20+7 >= 15 ? 2d6+4 : 0", 7.15, 0, 16},
+		{"(d{-3..3}+1)*2", 2, -4, 8},
+		{"1d6+1d6[fire]", 7, 2, 12},
+		{"1d20 vs 15", 10.5, 1, 20},
+		{"100d100", 5050, 100, 10000},
+	} {
+		stats, err := p.Stats(test.roll)
+		if assert.Nil(t, err, test.roll) {
+			assert.InDelta(t, stats.Totals.Mean(), test.mean, 0.0001, test.roll)
+			assert.EqualValues(t, stats.Totals.Min(), test.low, test.roll)
+			assert.EqualValues(t, stats.Totals.Max(), test.high, test.roll)
+			assert.False(t, stats.IsBool, test.roll)
+		}
+	}
+
+	stats, err := p.Stats("1d20+7 >= 15")
+	assert.Nil(t, err)
+	assert.True(t, stats.IsBool)
+	assert.True(t, stats.Exact)
+	assert.InDelta(t, stats.Totals.AtLeast(1), 0.65, 1e-12)
+
+	// Dice too big to work out exactly are estimated instead.
+	for _, roll := range []string{"1000000", "1d1000000", "1d9999999999", "1d1000000+1", "5..1000000", "d{0..999999}"} {
+		_, err = p.ExactStats(roll)
+		assert.EqualValues(t, err, errTooWide, roll)
+	}
+	stats, err = p.Stats("1d1000000")
+	assert.Nil(t, err)
+	assert.False(t, stats.Exact)
+
+	// Settings count.
+	p.setConfiguration(&configuration{NegativeTotals: "one", DivisionRounding: "up"})
+	stats, _ = p.Stats("1d4-2")
+	assert.EqualValues(t, stats.Totals.Min(), 1)
+	stats, _ = p.Stats("1d6/4")
+	assert.EqualValues(t, stats.Totals.Values(), []float64{1, 2})
+
+	for _, test := range []struct {
+		roll string
+		err  string
+	}{
+		{"1", "a one-sided die rolls off into the shadows"},
+		{"dnd", "I can only work out the odds of a single total"},
+		{"6x 4d6kh3", "I can only work out the odds of a single total"},
+		{"2d{hit,miss}", "only dice with numbers on them add up"},
+		{"1d6/(1d2-1)", "you can't divide by zero"},
+		{"monkey", "unexpected monkey"},
+	} {
+		_, err := p.Stats(test.roll)
+		if assert.NotNil(t, err, test.roll) {
+			assert.EqualValues(t, err.Error(), test.err, test.roll)
+		}
+	}
+}
+
+// TestStatsCache - Make sure distributions are remembered until the settings
+// change.
+func TestStatsCache(t *testing.T) {
+	p := initTestPlugin(t)
+	p.Init()
+
+	stats, err := p.Stats("d20")
+	assert.Nil(t, err)
+	assert.EqualValues(t, stats.Roll, "1d20")
+
+	again, _ := p.Stats("1d20")
+	assert.True(t, again == stats)
+
+	p.setConfiguration(&configuration{})
+	again, _ = p.Stats("1d20")
+	assert.False(t, again == stats)
+	assert.EqualValues(t, again, stats)
+
+	// Estimates aren't exact, even once they're remembered.
+	again, _ = p.ExactStats("d20")
+	assert.True(t, again.Exact)
+	_, err = p.ExactStats("1d6 until 6")
+	assert.EqualValues(t, err, errInexact)
+	_, err = p.Stats("1d6 until 6")
+	assert.Nil(t, err)
+	_, err = p.ExactStats("1d6 until 6")
+	assert.EqualValues(t, err, errInexact)
+}
+
+// TestStatsCommand - Make sure the stats are shown.
+func TestStatsCommand(t *testing.T) {
+	p := initTestPlugin(t)
+	assert.Nil(t, p.OnActivate())
+
+	run := func(cmd string) *model.CommandResponse {
+		resp, err := p.ExecuteCommand(&plugin.Context{}, &model.CommandArgs{Command: cmd})
+		assert.Nil(t, err)
+		return resp
+	}
+
+	resp := run("/roll stats 4d6kh3 vs 12,15,18")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_IN_CHANNEL)
+	assert.EqualValues(t, resp.Text, `📊 Stats for "4d6kh3", worked out exactly:
+Mean **12.24**, standard deviation 2.85, from 3 to 18.
+Percentiles: 10%: 8, 25%: 10, 50%: 12, 75%: 14, 90%: 16.
+`+"```"+`
+≤ 4 │█ 0.4%
+  5 │██ 0.8%
+  6 │████ 1.6%
+  7 │███████ 2.9%
+  8 │███████████ 4.8%
+  9 │████████████████ 7%
+ 10 │█████████████████████ 9.4%
+ 11 │██████████████████████████ 11.4%
+ 12 │█████████████████████████████ 12.9%
+ 13 │██████████████████████████████ 13.3%
+ 14 │████████████████████████████ 12.3%
+ 15 │███████████████████████ 10.1%
+ 16 │████████████████ 7.3%
+ 17 │█████████ 4.2%
+ 18 │████ 1.6%
+`+"```"+`
+
+| Target | Chance |
+|---:|---:|
+| ≥ 12 | 61.7% |
+| ≥ 15 | 23.1% |
+| ≥ 18 | 1.6% |
+
+📈 [Bar chart](/plugins/ca.taffer.mm-rolly/stats/chart.png?roll=4d6kh3)`)
+
+	resp = run("/roll stats 1d20+7 >= 15")
+	assert.EqualValues(t, resp.Text, "📊 Stats for \"1d20+7 >= 15\", worked out exactly:\nChance of yes: **65%**.")
+
+	resp = run("/roll stats 1d6/(1d2-1)")
+	assert.EqualValues(t, resp.ResponseType, model.COMMAND_RESPONSE_TYPE_EPHEMERAL)
+	assert.EqualValues(t, resp.Text, `I can't work out the odds of "1d6/(1d2-1)": you can't divide by zero.`)
+
+	resp = run("/roll stats")
+	assert.EqualValues(t, resp.Text, "Which roll? Like `/roll stats 4d6kh3`.")
+}
+
+// TestFormatChance - Make sure long shots don't look impossible.
+func TestFormatChance(t *testing.T) {
+	assert.EqualValues(t, FormatChance(0), "0%")
+	assert.EqualValues(t, FormatChance(0.0001), "< 0.1%")
+	assert.EqualValues(t, FormatChance(0.4213), "42.1%")
+	assert.EqualValues(t, FormatChance(0.9999), "> 99.9%")
+	assert.EqualValues(t, FormatChance(1), "100%")
+}